@@ -15,3 +15,13 @@ type Account interface {
 	// NewClusterService create the appropriate ClusterService for the account
 	NewClusterService() common.ClusterService
 }
+
+// LegacyAccount is implemented by accounts whose id has changed between releases,
+// so that the values cached under the previous id are still found
+type LegacyAccount interface {
+	// GetLegacyID returns the id used for the account by earlier releases
+	GetLegacyID() string
+
+	// MatchesLegacyEndpoint checks that an endpoint cached under the legacy id is for the account's region
+	MatchesLegacyEndpoint(endpoint string) bool
+}
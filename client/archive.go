@@ -0,0 +1,167 @@
+package client
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/getcarina/libcarina"
+	"github.com/pkg/errors"
+)
+
+const archiveFormatZip = "zip"
+const archiveFormatTarGz = "tar.gz"
+
+// maxArchiveFileSize guards against unreasonably large entries, a credentials bundle is only a few kilobytes
+const maxArchiveFileSize = 1 << 20
+
+// getArchiveFormat identifies the archive format from the destination filename, e.g. bundle.zip
+func getArchiveFormat(filename string) (string, error) {
+	name := strings.ToLower(filename)
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		return archiveFormatZip, nil
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return archiveFormatTarGz, nil
+	default:
+		return "", fmt.Errorf("Unsupported archive format: %s. Allowed extensions are .tar.gz, .tgz and .zip", filename)
+	}
+}
+
+// writeCredentialsArchive writes the files in a credentials bundle to an archive
+func writeCredentialsArchive(w io.Writer, creds *libcarina.CredentialsBundle, format string) error {
+	var filenames []string
+	for filename := range creds.Files {
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+
+	switch format {
+	case archiveFormatZip:
+		archive := zip.NewWriter(w)
+		for _, filename := range filenames {
+			header := &zip.FileHeader{Name: filename, Method: zip.Deflate}
+			header.SetModTime(time.Now())
+			header.SetMode(0600)
+			f, err := archive.CreateHeader(header)
+			if err != nil {
+				return errors.Wrapf(err, "Unable to add %s to the archive", filename)
+			}
+			if _, err = f.Write(creds.Files[filename]); err != nil {
+				return errors.Wrapf(err, "Unable to add %s to the archive", filename)
+			}
+		}
+		return archive.Close()
+	case archiveFormatTarGz:
+		gz := gzip.NewWriter(w)
+		archive := tar.NewWriter(gz)
+		for _, filename := range filenames {
+			contents := creds.Files[filename]
+			header := &tar.Header{
+				Name:    filename,
+				Mode:    0600,
+				Size:    int64(len(contents)),
+				ModTime: time.Now(),
+			}
+			if err := archive.WriteHeader(header); err != nil {
+				return errors.Wrapf(err, "Unable to add %s to the archive", filename)
+			}
+			if _, err := archive.Write(contents); err != nil {
+				return errors.Wrapf(err, "Unable to add %s to the archive", filename)
+			}
+		}
+		if err := archive.Close(); err != nil {
+			return err
+		}
+		return gz.Close()
+	default:
+		return fmt.Errorf("Unsupported archive format: %s", format)
+	}
+}
+
+// readCredentialsArchive loads a credentials bundle from a zip or tar.gz archive, detecting the format from its contents.
+// Directories within the archive are flattened, as a credentials bundle is always a single directory of files.
+func readCredentialsArchive(data []byte) (*libcarina.CredentialsBundle, error) {
+	creds := libcarina.NewCredentialsBundle()
+	addFile := func(name string, r io.Reader) error {
+		filename := path.Base(strings.Replace(name, "\\", "/", -1))
+		if filename == "." || filename == "/" || filename == ".." {
+			return fmt.Errorf("Invalid file in archive: %s", name)
+		}
+		if _, exists := creds.Files[filename]; exists {
+			return fmt.Errorf("Invalid archive, %s is present more than once", filename)
+		}
+
+		contents, err := ioutil.ReadAll(io.LimitReader(r, maxArchiveFileSize+1))
+		if err != nil {
+			return errors.Wrapf(err, "Unable to read %s from the archive", name)
+		}
+		if len(contents) > maxArchiveFileSize {
+			return fmt.Errorf("Invalid archive, %s is too large to be part of a credentials bundle", name)
+		}
+
+		creds.Files[filename] = contents
+		return nil
+	}
+
+	switch {
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")):
+		archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return nil, errors.Wrap(err, "Unable to read the zip archive")
+		}
+		for _, f := range archive.File {
+			if f.FileInfo().IsDir() {
+				continue
+			}
+			r, err := f.Open()
+			if err != nil {
+				return nil, errors.Wrapf(err, "Unable to read %s from the archive", f.Name)
+			}
+			err = addFile(f.Name, r)
+			r.Close()
+			if err != nil {
+				return nil, err
+			}
+		}
+	case bytes.HasPrefix(data, []byte{0x1f, 0x8b}):
+		gz, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, errors.Wrap(err, "Unable to read the tar.gz archive")
+		}
+		defer gz.Close()
+
+		archive := tar.NewReader(gz)
+		for {
+			header, err := archive.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, errors.Wrap(err, "Unable to read the tar.gz archive")
+			}
+			if header.Typeflag != tar.TypeReg && header.Typeflag != tar.TypeRegA {
+				continue
+			}
+			if err = addFile(header.Name, archive); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		return nil, errors.New("Unsupported archive format. Only .tar.gz and .zip archives are supported")
+	}
+
+	if len(creds.Files) == 0 {
+		return nil, errors.New("Invalid archive, no files were found")
+	}
+
+	return creds, nil
+}
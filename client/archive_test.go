@@ -0,0 +1,73 @@
+package client
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+
+	"github.com/getcarina/carina/common"
+	"github.com/getcarina/libcarina"
+	"github.com/stretchr/testify/assert"
+)
+
+func buildTestCredentialsBundle() *libcarina.CredentialsBundle {
+	creds := libcarina.NewCredentialsBundle()
+	creds.Files["ca.pem"] = []byte("ca")
+	creds.Files["cert.pem"] = []byte("cert")
+	creds.Files["key.pem"] = []byte("key")
+	creds.Files["docker.env"] = []byte("export DOCKER_HOST=tcp://example.com:2376")
+	return creds
+}
+
+func TestCredentialsArchiveRoundTrip(t *testing.T) {
+	for _, format := range []string{archiveFormatZip, archiveFormatTarGz} {
+		creds := buildTestCredentialsBundle()
+
+		var archive bytes.Buffer
+		err := writeCredentialsArchive(&archive, creds, format)
+		assert.Nil(t, err, format)
+
+		result, err := readCredentialsArchive(archive.Bytes())
+		assert.Nil(t, err, format)
+		assert.Equal(t, creds.Files, result.Files, format)
+	}
+}
+
+func TestEncryptedCredentialsArchiveRoundTrip(t *testing.T) {
+	var archive bytes.Buffer
+	err := writeCredentialsArchive(&archive, buildTestCredentialsBundle(), archiveFormatTarGz)
+	assert.Nil(t, err)
+
+	encrypted, err := common.EncryptWithPassphrase(archive.Bytes(), "ilovepuppies")
+	assert.Nil(t, err)
+	assert.True(t, common.IsEncrypted(encrypted))
+
+	_, err = common.DecryptWithPassphrase(encrypted, "ilovekittens")
+	assert.NotNil(t, err)
+
+	decrypted, err := common.DecryptWithPassphrase(encrypted, "ilovepuppies")
+	assert.Nil(t, err)
+	assert.Equal(t, archive.Bytes(), decrypted)
+}
+
+func TestReadCredentialsArchiveFlattensPaths(t *testing.T) {
+	var archive bytes.Buffer
+	w := zip.NewWriter(&archive)
+	f, _ := w.Create("../../mycluster/ca.pem")
+	f.Write([]byte("ca"))
+	w.Close()
+
+	creds, err := readCredentialsArchive(archive.Bytes())
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("ca"), creds.Files["ca.pem"])
+	assert.Len(t, creds.Files, 1)
+}
+
+func TestGetArchiveFormat(t *testing.T) {
+	format, err := getArchiveFormat("bundle.TGZ")
+	assert.Nil(t, err)
+	assert.Equal(t, archiveFormatTarGz, format)
+
+	_, err = getArchiveFormat("bundle.rar")
+	assert.NotNil(t, err)
+}
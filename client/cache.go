@@ -1,8 +1,10 @@
 package client
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"sync"
@@ -14,12 +16,48 @@ import (
 
 type cacheItem map[string]string
 
-// Cache is an on-disk cache of transient application values
+// secretCacheKeys are the account values which are encrypted when a secrets passphrase is set
+var secretCacheKeys = map[string]bool{
+	"token": true,
+}
+
+// cacheSchemaVersion is the version of the on-disk cache format written by this version of carina
+const cacheSchemaVersion = 2
+
+// cacheMigrations upgrade the raw on-disk cache, keyed by the schema version that they upgrade from
+var cacheMigrations = map[int]func(raw map[string]json.RawMessage) error{
+	// Version 1 is identical to version 2, except that it is missing the version field
+	1: func(raw map[string]json.RawMessage) error { return nil },
+}
+
+// Cache is an on-disk cache of transient application values.
+// Fields are never omitted, so that saving replaces the previous on-disk value.
 type Cache struct {
 	sync.Mutex
 	path            string
-	LastUpdateCheck time.Time            `json:"last-check"`
-	Accounts        map[string]cacheItem `json:"accounts"`
+	raw             map[string]json.RawMessage
+	passphrase      string
+	opened          map[string]string
+	Version         int                      `json:"version"`
+	LastUpdateCheck time.Time                `json:"last-check"`
+	Accounts        map[string]cacheItem     `json:"accounts"`
+	ActiveClusters  map[string]ActiveCluster `json:"active-clusters"`
+	LoadedCluster   *LoadedCluster           `json:"loaded-cluster"`
+}
+
+// LoadedCluster is the cluster most recently loaded with carina env
+type LoadedCluster struct {
+	Profile   string    `json:"profile"`
+	Cloud     string    `json:"cloud"`
+	Region    string    `json:"region"`
+	Cluster   string    `json:"cluster"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// ActiveCluster is the cluster selected with carina use, which is used when a cluster name is omitted
+type ActiveCluster struct {
+	Profile string `json:"profile"`
+	Name    string `json:"name"`
 }
 
 // CacheUnavailableError explains why the on-disk cache is unavailable
@@ -38,13 +76,13 @@ func (error CacheUnavailableError) Cause() error {
 }
 
 func newCache(path string) *Cache {
-	return &Cache{
-		path:     path,
-		Accounts: make(map[string]cacheItem),
-	}
+	cache := &Cache{path: path}
+	cache.reset()
+	return cache
 }
 
-func defaultCacheFilename() (string, error) {
+// GetCacheFilename returns the location of the on-disk cache
+func GetCacheFilename() (string, error) {
 	bd, err := GetCredentialsDir()
 	if err != nil {
 		return "", err
@@ -56,44 +94,169 @@ func (cache *Cache) isNil() bool {
 	return cache.path == ""
 }
 
-// Load reads the on disk cache into memory
+// Load reads the on disk cache into memory, replacing the in-memory values
 func (cache *Cache) load() error {
-	f, err := os.OpenFile(cache.path, os.O_RDONLY, 0666)
+	contents, err := ioutil.ReadFile(cache.path)
 	if os.IsNotExist(err) {
 		return nil
 	}
-	defer f.Close()
+	if err != nil {
+		return errors.Wrap(err, "Cannot read on-disk cache")
+	}
+
+	raw, err := decodeRawCache(contents)
+	if err != nil {
+		cache.quarantine(err)
+		return nil
+	}
+
+	err = migrateCache(raw)
+	if err != nil {
+		cache.quarantine(err)
+		return nil
+	}
+
+	cache.decodeFields(raw)
+	return nil
+}
 
-	err = json.NewDecoder(f).Decode(cache)
+// decodeRawCache splits the cache file into its top-level fields.
+// Trailing data after the JSON object, left behind by older versions of carina, is ignored.
+func decodeRawCache(contents []byte) (map[string]json.RawMessage, error) {
+	var raw map[string]json.RawMessage
+	err := json.NewDecoder(bytes.NewReader(contents)).Decode(&raw)
 	if err != nil {
-		common.Log.WriteDebug(errors.Wrap(err, "Unable to deserialize cache file, starting over with a fresh cache").Error())
+		return nil, errors.Wrap(err, "Unable to deserialize cache file")
+	}
+	if raw == nil {
+		return nil, errors.New("Unable to deserialize cache file, it does not contain an object")
+	}
+
+	return raw, nil
+}
+
+// migrateCache upgrades an older cache file in place to the current schema version
+func migrateCache(raw map[string]json.RawMessage) error {
+	version := 1
+	if value, ok := raw["version"]; ok {
+		err := json.Unmarshal(value, &version)
+		if err != nil {
+			return errors.Wrap(err, "Unable to read the cache schema version")
+		}
+	}
+
+	if version > cacheSchemaVersion {
+		common.Log.WriteDebug("The cache was written by a newer version of carina (schema version %d), unrecognized fields are preserved", version)
+		return nil
 	}
 
+	for ; version < cacheSchemaVersion; version++ {
+		common.Log.WriteDebug("Migrating the cache from schema version %d to %d", version, version+1)
+		err := cacheMigrations[version](raw)
+		if err != nil {
+			return errors.Wrapf(err, "Unable to migrate the cache from schema version %d", version)
+		}
+	}
+
+	raw["version"], _ = json.Marshal(cacheSchemaVersion)
 	return nil
 }
 
-// Save writes the in memory cache to disk
+// decodeFields loads each field, and each account, separately so that a corrupt entry only loses itself
+func (cache *Cache) decodeFields(raw map[string]json.RawMessage) {
+	decode := func(name string, value json.RawMessage, dest interface{}) bool {
+		err := json.Unmarshal(value, dest)
+		if err != nil {
+			common.Log.WriteDebug("Discarding corrupt cache entry %s: %s", name, err)
+			return false
+		}
+		return true
+	}
+
+	cache.reset()
+	cache.raw = raw
+
+	decode("version", raw["version"], &cache.Version)
+	if value, ok := raw["last-check"]; ok {
+		decode("last-check", value, &cache.LastUpdateCheck)
+	}
+	if value, ok := raw["loaded-cluster"]; ok {
+		decode("loaded-cluster", value, &cache.LoadedCluster)
+	}
+
+	var accounts map[string]json.RawMessage
+	if value, ok := raw["accounts"]; ok && decode("accounts", value, &accounts) {
+		for id, value := range accounts {
+			var item cacheItem
+			if decode("accounts."+id, value, &item) {
+				cache.Accounts[id] = item
+			}
+		}
+	}
+
+	var activeClusters map[string]json.RawMessage
+	if value, ok := raw["active-clusters"]; ok && decode("active-clusters", value, &activeClusters) {
+		for id, value := range activeClusters {
+			var active ActiveCluster
+			if decode("active-clusters."+id, value, &active) {
+				cache.ActiveClusters[id] = active
+			}
+		}
+	}
+}
+
+// quarantine moves a corrupt cache file aside, so that it can be inspected, and starts over with a fresh cache
+func (cache *Cache) quarantine(cause error) {
+	corruptPath := cache.path + ".corrupt"
+	err := os.Rename(cache.path, corruptPath)
+	if err != nil {
+		common.Log.WriteDebug("Unable to move the corrupt cache aside: %s", err)
+	}
+
+	common.Log.WriteWarning("The cache was corrupt and has been reset, the previous cache was moved to %s", corruptPath)
+	common.Log.WriteDebug(cause.Error())
+	cache.reset()
+}
+
+// reset clears the in-memory values, without touching the lock
+func (cache *Cache) reset() {
+	cache.raw = nil
+	cache.Version = cacheSchemaVersion
+	cache.LastUpdateCheck = time.Time{}
+	cache.Accounts = make(map[string]cacheItem)
+	cache.ActiveClusters = make(map[string]ActiveCluster)
+	cache.LoadedCluster = nil
+}
+
+// Save writes the in memory cache to disk, replacing the previous file atomically
 func (cache *Cache) save() error {
-	f, err := os.OpenFile(cache.path, os.O_WRONLY|os.O_CREATE, 0666)
-	defer f.Close()
+	contents, err := json.Marshal(cache)
 	if err != nil {
-		return errors.Wrap(err, "Cannot open on-disk cache")
+		return errors.Wrap(err, "Cannot serialize in-memory cache")
 	}
 
-	contents, err := json.MarshalIndent(cache, "", "  ")
+	// Keep fields written by newer versions of carina
+	var fields map[string]json.RawMessage
+	err = json.Unmarshal(contents, &fields)
 	if err != nil {
 		return errors.Wrap(err, "Cannot serialize in-memory cache")
 	}
+	for name, value := range cache.raw {
+		if _, ok := fields[name]; !ok {
+			fields[name] = value
+		}
+	}
 
-	_, err = f.Write(contents)
+	contents, err = json.MarshalIndent(fields, "", "  ")
 	if err != nil {
-		return errors.Wrap(err, "Cannot write to on-disk cache")
+		return errors.Wrap(err, "Cannot serialize in-memory cache")
 	}
 
-	return nil
+	return errors.Wrap(WriteFileAtomic(cache.path, contents, 0600), "Cannot write to on-disk cache")
 }
 
-// update handles locking and loading the on-disk cache before an update
+// update handles locking and loading the on-disk cache before an update.
+// The file lock serializes updates across carina processes, e.g. parallel invocations in CI.
 func (cache *Cache) safeUpdate(action func(*Cache)) error {
 	if cache.isNil() {
 		return nil
@@ -101,7 +264,14 @@ func (cache *Cache) safeUpdate(action func(*Cache)) error {
 
 	cache.Lock()
 	defer cache.Unlock()
-	err := cache.load()
+
+	lock, err := acquireFileLock(cache.path)
+	if err != nil {
+		return errors.Wrap(err, "Cannot lock on-disk cache")
+	}
+	defer lock.release()
+
+	err = cache.load()
 	if err != nil {
 		return err
 	}
@@ -112,12 +282,96 @@ func (cache *Cache) safeUpdate(action func(*Cache)) error {
 }
 
 func (cache *Cache) apply(account Account) {
+	cache.Lock()
+	defer cache.Unlock()
+
 	accountCache, exists := cache.Accounts[account.GetID()]
 	if !exists {
-		return
+		legacyID := getLegacyAccountID(account)
+		accountCache, exists = cache.Accounts[legacyID]
+		if legacyID == "" || !exists {
+			return
+		}
+		if cache.matchesLegacyAccount(account, legacyID) {
+			common.Log.WriteDebug("Using the account cache saved by an earlier release (%s)", legacyID)
+		} else {
+			common.Log.WriteDebug("Using only the token from the account cache saved by an earlier release (%s), its endpoint is for another region", legacyID)
+			accountCache = withoutEndpoint(accountCache)
+		}
 	}
 
-	account.ApplyCache(accountCache)
+	account.ApplyCache(cache.openSecrets(accountCache))
+}
+
+// openSecrets decrypts the secret values of a cached account. A value which cannot be decrypted is treated as missing.
+func (cache *Cache) openSecrets(item cacheItem) map[string]string {
+	opened := make(map[string]string, len(item))
+	for key, value := range item {
+		if !common.IsEncryptedString(value) {
+			opened[key] = value
+			continue
+		}
+
+		if cache.passphrase == "" {
+			common.Log.WriteDebug("Ignoring the cached %s because it is encrypted, set %s to use it", key, CarinaSecretsPassphraseEnvVar)
+			continue
+		}
+
+		plaintext, err := common.DecryptString(value, cache.passphrase)
+		if err != nil {
+			common.Log.WriteDebug("Ignoring the cached %s: %s", key, err)
+			continue
+		}
+		cache.rememberSecret(value, plaintext)
+		opened[key] = plaintext
+	}
+
+	return opened
+}
+
+// rememberSecret records the plaintext of a ciphertext, so that an unchanged secret is not encrypted again
+func (cache *Cache) rememberSecret(ciphertext string, plaintext string) {
+	if cache.opened == nil {
+		cache.opened = make(map[string]string)
+	}
+	cache.opened[ciphertext] = plaintext
+}
+
+// sealSecrets encrypts the secret values of an account before it is cached, when a secrets passphrase is set.
+// Unchanged secrets keep their previous ciphertext, and a secret which was encrypted is never cached in plaintext.
+func (cache *Cache) sealSecrets(previous cacheItem, item map[string]string) cacheItem {
+	sealed := make(cacheItem, len(item))
+	for key, value := range item {
+		if !secretCacheKeys[key] || value == "" || common.IsEncryptedString(value) {
+			sealed[key] = value
+			continue
+		}
+
+		if cache.passphrase == "" {
+			if common.IsEncryptedString(previous[key]) {
+				common.Log.WriteDebug("Not caching the %s because the cache is encrypted, set %s to update it", key, CarinaSecretsPassphraseEnvVar)
+				sealed[key] = previous[key]
+				continue
+			}
+			sealed[key] = value
+			continue
+		}
+
+		if ciphertext := previous[key]; ciphertext != "" && cache.opened[ciphertext] == value {
+			sealed[key] = ciphertext
+			continue
+		}
+
+		ciphertext, err := common.EncryptString(value, cache.passphrase)
+		if err != nil {
+			common.Log.WriteDebug("Not caching the %s: %s", key, err)
+			continue
+		}
+		cache.rememberSecret(ciphertext, value)
+		sealed[key] = ciphertext
+	}
+
+	return sealed
 }
 
 // SaveLastUpdateCheck caches the last time that we checked for updates
@@ -135,6 +389,188 @@ func (cache *Cache) SaveAccount(account Account) error {
 			common.Log.WriteDebug("Skipping updating the account cache because it is empty")
 		}
 
-		c.Accounts[account.GetID()] = accountCache
+		id := account.GetID()
+		previous, exists := c.Accounts[id]
+		if legacyID := getLegacyAccountID(account); legacyID != "" {
+			if c.matchesLegacyAccount(account, legacyID) {
+				if !exists {
+					previous = c.Accounts[legacyID]
+				}
+				// Move the account cache to its current id
+				delete(c.Accounts, legacyID)
+			} else if !exists {
+				previous = withoutEndpoint(c.Accounts[legacyID])
+			}
+		}
+		c.Accounts[id] = c.sealSecrets(previous, accountCache)
+	})
+}
+
+// SaveActiveCluster selects the cluster to use for the account when a cluster name is omitted.
+// An empty name clears the selection.
+func (cache *Cache) SaveActiveCluster(account Account, profile string, name string) error {
+	if cache.isNil() {
+		return errors.New("Unable to save the active cluster because the cache is disabled")
+	}
+
+	return cache.safeUpdate(func(c *Cache) {
+		if c.ActiveClusters == nil {
+			c.ActiveClusters = make(map[string]ActiveCluster)
+		}
+
+		if legacyID := getLegacyAccountID(account); legacyID != "" && c.matchesLegacyAccount(account, legacyID) {
+			delete(c.ActiveClusters, legacyID)
+		}
+
+		if name == "" {
+			delete(c.ActiveClusters, account.GetID())
+			return
+		}
+		c.ActiveClusters[account.GetID()] = ActiveCluster{Profile: profile, Name: name}
 	})
 }
+
+// GetActiveCluster returns the cluster selected for the account, if any
+func (cache *Cache) GetActiveCluster(account Account) (ActiveCluster, bool) {
+	cache.Lock()
+	defer cache.Unlock()
+
+	active, ok := cache.ActiveClusters[account.GetID()]
+	if legacyID := getLegacyAccountID(account); !ok && legacyID != "" && cache.matchesLegacyAccount(account, legacyID) {
+		active, ok = cache.ActiveClusters[legacyID]
+	}
+	return active, ok
+}
+
+// getLegacyAccountID returns the id used for the account by earlier releases,
+// or an empty string when the account's id has not changed
+func getLegacyAccountID(account Account) string {
+	legacy, ok := account.(LegacyAccount)
+	if !ok {
+		return ""
+	}
+
+	id := legacy.GetLegacyID()
+	if id == account.GetID() {
+		return ""
+	}
+	return id
+}
+
+// matchesLegacyAccount checks that the values cached under the legacy id are for the account's region.
+// Earlier releases did not include the region in the id, so the cached endpoint may be for any region.
+func (cache *Cache) matchesLegacyAccount(account Account, legacyID string) bool {
+	legacy, ok := account.(LegacyAccount)
+	if !ok {
+		return false
+	}
+	return legacy.MatchesLegacyEndpoint(cache.Accounts[legacyID]["endpoint"])
+}
+
+// withoutEndpoint copies a cached account, leaving out its endpoint
+func withoutEndpoint(item cacheItem) cacheItem {
+	if item == nil {
+		return nil
+	}
+
+	copied := make(cacheItem, len(item))
+	for key, value := range item {
+		if key != "endpoint" {
+			copied[key] = value
+		}
+	}
+	return copied
+}
+
+// SaveLoadedCluster caches the cluster most recently loaded with carina env
+func (cache *Cache) SaveLoadedCluster(loaded LoadedCluster) error {
+	return cache.safeUpdate(func(c *Cache) {
+		c.LoadedCluster = &loaded
+	})
+}
+
+// Path returns the location of the on-disk cache, or an empty string when the cache is disabled
+func (cache *Cache) Path() string {
+	return cache.path
+}
+
+// Clear removes every cached value, including the shell completion cache
+func (cache *Cache) Clear() error {
+	if cache.isNil() {
+		return errors.New("Unable to clear the cache because it is disabled")
+	}
+
+	err := cache.safeUpdate(func(c *Cache) {
+		c.reset()
+	})
+	if err != nil {
+		return err
+	}
+
+	completionPath := newCompletionCache(cache).path
+	err = os.Remove(completionPath)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "Unable to remove %s", completionPath)
+	}
+
+	return nil
+}
+
+// ClearAccount removes the cached values for a single account, such as its token and selected cluster.
+// Returns false when nothing was cached for the account.
+func (cache *Cache) ClearAccount(id string) (bool, error) {
+	if cache.isNil() {
+		return false, errors.New("Unable to clear the cache because it is disabled")
+	}
+
+	var found bool
+	err := cache.safeUpdate(func(c *Cache) {
+		_, hasAccount := c.Accounts[id]
+		_, hasActiveCluster := c.ActiveClusters[id]
+		found = hasAccount || hasActiveCluster
+
+		delete(c.Accounts, id)
+		delete(c.ActiveClusters, id)
+	})
+	if err != nil {
+		return false, err
+	}
+
+	completion := newCompletionCache(cache)
+	completion.load()
+	_, hasClusters := completion.Clusters[id]
+	_, hasTemplates := completion.Templates[id]
+	if hasClusters || hasTemplates {
+		found = true
+		delete(completion.Clusters, id)
+		delete(completion.Templates, id)
+		err = completion.save()
+	}
+
+	return found, err
+}
+
+// EncryptSecrets encrypts the secrets of every cached account with the secrets passphrase, returning how many were encrypted
+func (cache *Cache) EncryptSecrets() (int, error) {
+	if cache.isNil() {
+		return 0, errors.New("Unable to encrypt the cache because it is disabled")
+	}
+	if cache.passphrase == "" {
+		return 0, fmt.Errorf("Unable to encrypt the cache, %s is not set", CarinaSecretsPassphraseEnvVar)
+	}
+
+	var count int
+	err := cache.safeUpdate(func(c *Cache) {
+		for id, item := range c.Accounts {
+			sealed := c.sealSecrets(item, item)
+			for key, value := range sealed {
+				if value != item[key] {
+					count++
+				}
+			}
+			c.Accounts[id] = sealed
+		}
+	})
+
+	return count, err
+}
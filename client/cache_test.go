@@ -2,8 +2,11 @@ package client
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -34,6 +37,7 @@ func TestLoadCache(t *testing.T) {
 	filename := fmt.Sprintf("carina-temp-cache-%s.json", randomName())
 
 	// Try to clean up as best we can
+	defer os.Remove(filename + ".lock")
 	defer func() {
 		err := os.Remove(filename)
 		if err != nil {
@@ -68,3 +72,415 @@ func TestLoadCache(t *testing.T) {
 	}
 
 }
+
+func TestActiveClusterIsScopedToAccount(t *testing.T) {
+	filename := fmt.Sprintf("carina-temp-cache-%s.json", randomName())
+	defer os.Remove(filename)
+	defer os.Remove(filename + ".lock")
+
+	dev := &stubAccount{id: "dev-user"}
+	prod := &stubAccount{id: "prod-user"}
+
+	cache := newCache(filename)
+	err := cache.SaveActiveCluster(dev, "dev", "mycluster")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cache = newCache(filename)
+	cache.load()
+
+	active, ok := cache.GetActiveCluster(dev)
+	if !ok || active.Name != "mycluster" || active.Profile != "dev" {
+		t.Errorf("Expected mycluster from the dev profile, got %v", active)
+	}
+
+	_, ok = cache.GetActiveCluster(prod)
+	if ok {
+		t.Error("Expected no active cluster for a different account")
+	}
+}
+
+func TestSaveTruncatesPreviousCache(t *testing.T) {
+	dir := tempCacheDir(t)
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "cache.json")
+
+	junk := `{"accounts": {}}` + strings.Repeat(" junk", 1000)
+	err := ioutil.WriteFile(filename, []byte(junk), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cache := newCache(filename)
+	err = cache.SaveLastUpdateCheck(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	contents, _ := ioutil.ReadFile(filename)
+	if strings.Contains(string(contents), "junk") {
+		t.Errorf("Expected the previous cache to be replaced, got %s", contents)
+	}
+}
+
+func TestLoadDiscardsOnlyCorruptAccounts(t *testing.T) {
+	dir := tempCacheDir(t)
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "cache.json")
+
+	contents := `{"version": 2, "accounts": {"good": {"token": "abc"}, "bad": 42}, "future-field": {"a": 1}}`
+	err := ioutil.WriteFile(filename, []byte(contents), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cache := newCache(filename)
+	cache.load()
+
+	if cache.Accounts["good"]["token"] != "abc" {
+		t.Errorf("Expected the valid account to be loaded, got %v", cache.Accounts)
+	}
+	if _, ok := cache.Accounts["bad"]; ok {
+		t.Error("Expected the corrupt account to be discarded")
+	}
+
+	err = cache.SaveLastUpdateCheck(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	saved, _ := ioutil.ReadFile(filename)
+	if !strings.Contains(string(saved), "future-field") {
+		t.Errorf("Expected unrecognized fields to be preserved, got %s", saved)
+	}
+}
+
+func TestLoadQuarantinesCorruptCache(t *testing.T) {
+	dir := tempCacheDir(t)
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "cache.json")
+
+	err := ioutil.WriteFile(filename, []byte(`{"accounts": {"good": {"tok`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cache := newCache(filename)
+	err = cache.load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(cache.Accounts) != 0 {
+		t.Errorf("Expected a fresh cache, got %v", cache.Accounts)
+	}
+	if _, err := os.Stat(filename + ".corrupt"); err != nil {
+		t.Errorf("Expected the corrupt cache to be moved aside: %v", err)
+	}
+}
+
+func TestLoadMigratesUnversionedCache(t *testing.T) {
+	dir := tempCacheDir(t)
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "cache.json")
+
+	err := ioutil.WriteFile(filename, []byte(`{"accounts": {"dev-user": {"token": "abc"}}}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cache := newCache(filename)
+	cache.load()
+
+	if cache.Version != cacheSchemaVersion {
+		t.Errorf("Expected schema version %d, got %d", cacheSchemaVersion, cache.Version)
+	}
+	if cache.Accounts["dev-user"]["token"] != "abc" {
+		t.Errorf("Expected the account to survive the migration, got %v", cache.Accounts)
+	}
+}
+
+func TestLegacyAccountIDIsMigrated(t *testing.T) {
+	dir := tempCacheDir(t)
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "cache.json")
+
+	legacy := &stubAccount{id: "public-user", cache: map[string]string{"token": "abc", "endpoint": "https://api.dfw.getcarina.com"}}
+	cache := newCache(filename)
+	err := cache.SaveAccount(legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = cache.SaveActiveCluster(legacy, "", "mycluster")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	account := &legacyStubAccount{stubAccount: stubAccount{id: "public-dfw-user", cache: map[string]string{"token": "abc"}}, legacyID: "public-user", region: "dfw"}
+	cache = newCache(filename)
+	cache.load()
+	cache.apply(account)
+	if account.applied["token"] != "abc" || account.applied["endpoint"] != "https://api.dfw.getcarina.com" {
+		t.Errorf("Expected the token and endpoint cached under the legacy id, got %v", account.applied)
+	}
+	active, ok := cache.GetActiveCluster(account)
+	if !ok || active.Name != "mycluster" {
+		t.Errorf("Expected the active cluster selected under the legacy id, got %v", active)
+	}
+
+	err = cache.SaveAccount(account)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache = newCache(filename)
+	cache.load()
+	if _, ok := cache.Accounts["public-user"]; ok {
+		t.Error("Expected the legacy account cache to be removed")
+	}
+	if _, ok := cache.Accounts["public-dfw-user"]; !ok {
+		t.Errorf("Expected the account cache to be moved to its current id, got %v", cache.Accounts)
+	}
+}
+
+func TestConcurrentUpdatesDoNotLoseAccounts(t *testing.T) {
+	dir := tempCacheDir(t)
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "cache.json")
+
+	// Each cache has its own mutex, as if it belonged to a separate carina process
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			account := &stubAccount{id: fmt.Sprintf("user-%d", i), cache: map[string]string{"token": "abc"}}
+			err := newCache(filename).SaveAccount(account)
+			if err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	cache := newCache(filename)
+	cache.load()
+	if len(cache.Accounts) != 20 {
+		t.Errorf("Expected 20 accounts, got %d", len(cache.Accounts))
+	}
+}
+
+func TestClearAccountKeepsOtherAccounts(t *testing.T) {
+	dir := tempCacheDir(t)
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "cache.json")
+
+	dev := &stubAccount{id: "dev-user", cache: map[string]string{"token": "abc"}}
+	prod := &stubAccount{id: "prod-user", cache: map[string]string{"token": "xyz"}}
+
+	cache := newCache(filename)
+	cache.SaveAccount(dev)
+	cache.SaveAccount(prod)
+	cache.SaveActiveCluster(dev, "dev", "mycluster")
+
+	found, err := cache.ClearAccount(dev.GetID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !found {
+		t.Error("Expected the dev account to be found")
+	}
+
+	cache = newCache(filename)
+	cache.load()
+	if _, ok := cache.Accounts[dev.GetID()]; ok {
+		t.Error("Expected the dev account to be cleared")
+	}
+	if _, ok := cache.GetActiveCluster(dev); ok {
+		t.Error("Expected the dev active cluster to be cleared")
+	}
+	if cache.Accounts[prod.GetID()]["token"] != "xyz" {
+		t.Errorf("Expected the prod account to be kept, got %v", cache.Accounts)
+	}
+
+	found, err = cache.ClearAccount("missing-user")
+	if err != nil || found {
+		t.Errorf("Expected nothing to be found for an unknown account, got %v %v", found, err)
+	}
+}
+
+func TestCachedTokensAreEncrypted(t *testing.T) {
+	dir := tempCacheDir(t)
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "cache.json")
+
+	account := &stubAccount{id: "dev-user", cache: map[string]string{"token": "abc", "endpoint": "http://example.com"}}
+
+	cache := newCache(filename)
+	cache.passphrase = "ilovepuppies"
+	cache.SaveAccount(account)
+
+	contents, _ := ioutil.ReadFile(filename)
+	if strings.Contains(string(contents), `"abc"`) {
+		t.Fatalf("Expected the token to be encrypted, got %s", contents)
+	}
+	ciphertext := cache.Accounts[account.GetID()]["token"]
+	if !common.IsEncryptedString(ciphertext) {
+		t.Fatalf("Expected the token to be encrypted, got %s", ciphertext)
+	}
+
+	// Saving the same token again keeps the ciphertext
+	cache.SaveAccount(account)
+	if cache.Accounts[account.GetID()]["token"] != ciphertext {
+		t.Error("Expected an unchanged token to keep its ciphertext")
+	}
+
+	cache = newCache(filename)
+	cache.passphrase = "ilovepuppies"
+	cache.load()
+	cache.apply(account)
+	if account.applied["token"] != "abc" || account.applied["endpoint"] != "http://example.com" {
+		t.Errorf("Expected the cached values to be decrypted, got %v", account.applied)
+	}
+
+	// Without the passphrase the token is ignored, and the cache is not downgraded to plaintext
+	cache = newCache(filename)
+	cache.load()
+	cache.apply(account)
+	if _, ok := account.applied["token"]; ok {
+		t.Errorf("Expected the encrypted token to be ignored, got %v", account.applied)
+	}
+	account.cache["token"] = "xyz"
+	cache.SaveAccount(account)
+	if cache.Accounts[account.GetID()]["token"] != ciphertext {
+		t.Errorf("Expected the encrypted token to be kept, got %s", cache.Accounts[account.GetID()]["token"])
+	}
+}
+
+func TestEncryptSecrets(t *testing.T) {
+	dir := tempCacheDir(t)
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "cache.json")
+
+	account := &stubAccount{id: "dev-user", cache: map[string]string{"token": "abc", "endpoint": "http://example.com"}}
+
+	cache := newCache(filename)
+	cache.SaveAccount(account)
+	if cache.Accounts[account.GetID()]["token"] != "abc" {
+		t.Fatal("Expected the token to be cached in plaintext without a passphrase")
+	}
+
+	_, err := cache.EncryptSecrets()
+	if err == nil {
+		t.Error("Expected an error when no passphrase is set")
+	}
+
+	cache.passphrase = "ilovepuppies"
+	count, err := cache.EncryptSecrets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("Expected 1 secret to be encrypted, got %d", count)
+	}
+
+	cache = newCache(filename)
+	cache.load()
+	item := cache.Accounts[account.GetID()]
+	if !common.IsEncryptedString(item["token"]) || item["endpoint"] != "http://example.com" {
+		t.Errorf("Expected only the token to be encrypted, got %v", item)
+	}
+}
+
+func TestLegacyAccountCacheForAnotherRegion(t *testing.T) {
+	dir := tempCacheDir(t)
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "cache.json")
+
+	legacy := &stubAccount{id: "public-user", cache: map[string]string{"token": "abc", "endpoint": "https://api.dfw.getcarina.com"}}
+	cache := newCache(filename)
+	err := cache.SaveAccount(legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = cache.SaveActiveCluster(legacy, "", "mycluster")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	account := &legacyStubAccount{stubAccount: stubAccount{id: "public-iad-user"}, legacyID: "public-user", region: "iad"}
+	cache = newCache(filename)
+	cache.load()
+	cache.apply(account)
+	if account.applied["token"] != "abc" {
+		t.Errorf("Expected the token cached under the legacy id, got %v", account.applied)
+	}
+	if _, ok := account.applied["endpoint"]; ok {
+		t.Errorf("Expected the endpoint for another region to be dropped, got %v", account.applied)
+	}
+	if active, ok := cache.GetActiveCluster(account); ok {
+		t.Errorf("Expected the active cluster for another region to be ignored, got %v", active)
+	}
+
+	account.cache = map[string]string{"token": "abc", "endpoint": "https://api.iad.getcarina.com"}
+	err = cache.SaveAccount(account)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = cache.SaveActiveCluster(account, "", "other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache = newCache(filename)
+	cache.load()
+	if cache.Accounts["public-user"]["endpoint"] != "https://api.dfw.getcarina.com" {
+		t.Errorf("Expected the legacy account cache to be kept for its own region, got %v", cache.Accounts)
+	}
+	if cache.Accounts["public-iad-user"]["endpoint"] != "https://api.iad.getcarina.com" {
+		t.Errorf("Expected the account cache to be saved with its own endpoint, got %v", cache.Accounts)
+	}
+	if cache.ActiveClusters["public-user"].Name != "mycluster" {
+		t.Errorf("Expected the legacy active cluster to be kept for its own region, got %v", cache.ActiveClusters)
+	}
+}
+
+func tempCacheDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "carina-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+type stubAccount struct {
+	Account
+	id      string
+	cache   map[string]string
+	applied map[string]string
+}
+
+func (account *stubAccount) GetID() string {
+	return account.id
+}
+
+func (account *stubAccount) BuildCache() map[string]string {
+	return account.cache
+}
+
+func (account *stubAccount) ApplyCache(c map[string]string) {
+	account.applied = c
+}
+
+type legacyStubAccount struct {
+	stubAccount
+	legacyID string
+	region   string
+}
+
+func (account *legacyStubAccount) GetLegacyID() string {
+	return account.legacyID
+}
+
+func (account *legacyStubAccount) MatchesLegacyEndpoint(endpoint string) bool {
+	return strings.Contains(endpoint, "."+account.region+".")
+}
@@ -1,9 +1,11 @@
 package client
 
 import (
+	"bytes"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sync"
 
 	"github.com/getcarina/carina/common"
 	"github.com/getcarina/libcarina"
@@ -20,6 +22,16 @@ type Client struct {
 // CarinaHomeDirEnvVar is the environment variable name for carina data, config, etc.
 const CarinaHomeDirEnvVar = "CARINA_HOME"
 
+// CarinaClusterEnvVar is the cluster loaded into the current shell with carina env
+const CarinaClusterEnvVar = "CARINA_CLUSTER"
+
+// CarinaEnvProfileEnvVar is the profile of the cluster loaded into the current shell with carina env.
+// It is only displayed by carina prompt, unlike CARINA_PROFILE it does not select the profile used by later commands.
+const CarinaEnvProfileEnvVar = "CARINA_ENV_PROFILE"
+
+// CarinaSecretsPassphraseEnvVar is the passphrase used to encrypt cached tokens and profile secrets at rest
+const CarinaSecretsPassphraseEnvVar = "CARINA_SECRETS_PASSPHRASE"
+
 // CloudMakeSwarm is the v1 Carina (make-swarm) cloud type
 const CloudMakeSwarm = "make-swarm"
 
@@ -70,13 +82,14 @@ func (client *Client) initCache(cacheEnabled bool) {
 		return
 	}
 
-	path, err := defaultCacheFilename()
+	path, err := GetCacheFilename()
 	if err != nil {
 		disableCache(err)
 		return
 	}
 
 	client.Cache = newCache(path)
+	client.Cache.passphrase = os.Getenv(CarinaSecretsPassphraseEnvVar)
 	err = client.Cache.load()
 	if err != nil {
 		disableCache(err)
@@ -135,33 +148,86 @@ func (client *Client) DownloadClusterCredentials(account Account, name string, c
 		return "", errors.Wrap(err, "Unable to save downloaded cluster credentials")
 	}
 
+	err = saveClusterCredentials(creds, credentialsPath)
+	if err != nil {
+		return "", err
+	}
+
+	return credentialsPath, nil
+}
+
+// RotateClusterCredentials invalidates a cluster's existing credentials and then downloads a new credentials bundle.
+// The kubeconfig and docker context entries for the cluster are pointed at the new credentials, and returned.
+func (client *Client) RotateClusterCredentials(account Account, name string, customPath string) (credentialsPath string, updatedContexts []string, err error) {
+	defer client.Cache.SaveAccount(account)
+	svc, err := client.buildContainerService(account)
+	if err != nil {
+		return "", nil, err
+	}
+
+	err = svc.RotateClusterCredentials(name)
+	if err != nil {
+		return "", nil, wrapClientError(err)
+	}
+
+	// Rotation updates the cluster in the background, wait for it to finish before requesting new credentials
+	cluster, err := svc.GetCluster(name)
+	if err == nil {
+		_, err = svc.WaitUntilClusterIsActive(cluster)
+	}
+	if err != nil {
+		return "", nil, wrapClientError(err)
+	}
+
+	// Remove the old bundle so that no stale files are left behind
+	err = client.DeleteClusterCredentials(account, name, customPath)
+	if err != nil {
+		return "", nil, err
+	}
+
+	credentialsPath, err = client.DownloadClusterCredentials(account, name, customPath)
+	if err != nil {
+		return "", nil, err
+	}
+
+	creds := libcarina.LoadCredentialsBundle(credentialsPath)
+	updatedContexts, err = updateClusterContexts(credentialsPath, creds)
+	if err != nil {
+		return credentialsPath, updatedContexts, errors.Wrap(err, "Rotated the cluster credentials but was unable to update the kubeconfig and docker contexts")
+	}
+
+	return credentialsPath, updatedContexts, nil
+}
+
+// saveClusterCredentials writes the files in a credentials bundle to the specified directory
+func saveClusterCredentials(creds *libcarina.CredentialsBundle, credentialsPath string) error {
 	// Ensure the credentials destination directory exists
 	if credentialsPath != "." {
-		err = os.MkdirAll(credentialsPath, 0777)
+		err := os.MkdirAll(credentialsPath, 0777)
 		if err != nil {
-			return "", err
+			return err
 		}
 	}
 
 	for file, fileContents := range creds.Files {
 		file = filepath.Join(credentialsPath, file)
-		err = ioutil.WriteFile(file, fileContents, 0600)
+		err := ioutil.WriteFile(file, fileContents, 0600)
 		if err != nil {
-			return "", err
+			return err
 		}
 	}
 
-	return credentialsPath, nil
+	return nil
 }
 
-// GetSourceCommand returns the shell command and appropriate help text to load a cluster's credentials
-func (client *Client) GetSourceCommand(account Account, shell string, name string, customPath string) (sourceText string, err error) {
+// getVerifiedClusterCredentialsPath returns the path to a cluster's credentials, downloading them if they are missing or invalid
+func (client *Client) getVerifiedClusterCredentialsPath(account Account, name string, customPath string) (string, error) {
 	// We are ignoring errors here, and checking lower down if the creds are missing
 	credentialsPath, _ := buildClusterCredentialsPath(account, name, customPath)
 	creds := libcarina.LoadCredentialsBundle(credentialsPath)
 
 	// Re-download the credentials bundle, if the credentials are invalid
-	err = creds.Verify()
+	err := creds.Verify()
 	if err != nil {
 		common.Log.Debug(err)
 		common.Log.Debugln("Re-downloading credentials due to missing or invalid credentials bundle.")
@@ -172,12 +238,112 @@ func (client *Client) GetSourceCommand(account Account, shell string, name strin
 		}
 	}
 
+	return credentialsPath, nil
+}
+
+// ExportClusterCredentials writes a cluster's credentials to a zip or tar.gz archive, optionally encrypted with a passphrase
+func (client *Client) ExportClusterCredentials(account Account, name string, customPath string, archivePath string, passphrase string) error {
+	format, err := getArchiveFormat(archivePath)
+	if err != nil {
+		return err
+	}
+
+	credentialsPath, err := client.getVerifiedClusterCredentialsPath(account, name, customPath)
+	if err != nil {
+		return err
+	}
+	creds := libcarina.LoadCredentialsBundle(credentialsPath)
+
+	var archive bytes.Buffer
+	err = writeCredentialsArchive(&archive, creds, format)
+	if err != nil {
+		return errors.Wrap(err, "Unable to build the credentials archive")
+	}
+
+	contents := archive.Bytes()
+	if passphrase != "" {
+		common.Log.WriteDebug("Encrypting the credentials archive with the passphrase")
+		contents, err = common.EncryptWithPassphrase(contents, passphrase)
+		if err != nil {
+			return errors.Wrap(err, "Unable to encrypt the credentials archive")
+		}
+	}
+
+	err = ioutil.WriteFile(archivePath, contents, 0600)
+	if err != nil {
+		return errors.Wrap(err, "Unable to write the credentials archive")
+	}
+
+	return nil
+}
+
+// ImportClusterCredentials validates the credentials in an archive and saves them where the cluster's downloaded credentials are stored
+func (client *Client) ImportClusterCredentials(account Account, name string, archivePath string, customPath string, passphrase string) (credentialsPath string, err error) {
+	contents, err := ioutil.ReadFile(archivePath)
+	if err != nil {
+		return "", errors.Wrap(err, "Unable to read the credentials archive")
+	}
+
+	if common.IsEncrypted(contents) {
+		if passphrase == "" {
+			return "", errors.New("The credentials archive is encrypted, a passphrase is required")
+		}
+		common.Log.WriteDebug("Decrypting the credentials archive with the passphrase")
+		contents, err = common.DecryptWithPassphrase(contents, passphrase)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	creds, err := readCredentialsArchive(contents)
+	if err != nil {
+		return "", err
+	}
+
+	err = creds.Verify()
+	if err != nil {
+		return "", errors.Wrap(err, "Invalid credentials bundle")
+	}
+
+	defer client.Cache.SaveAccount(account)
+	svc, err := client.buildContainerService(account)
+	if err != nil {
+		return "", err
+	}
+
+	// Make sure the cluster exists on this account, which also looks up the cluster prefix used in the credentials path
+	_, err = svc.GetCluster(name)
+	if err != nil {
+		return "", wrapClientError(err)
+	}
+
+	credentialsPath, err = buildClusterCredentialsPath(account, name, customPath)
+	if err != nil {
+		return "", errors.Wrap(err, "Unable to save imported cluster credentials")
+	}
+
+	err = saveClusterCredentials(creds, credentialsPath)
+	if err != nil {
+		return "", err
+	}
+
+	return credentialsPath, nil
+}
+
+// GetSourceCommand returns the shell command and appropriate help text to load a cluster's credentials.
+// The variables are set in the shell by the same command, and a variable with an empty value is unset.
+func (client *Client) GetSourceCommand(account Account, shell string, name string, customPath string, variables []ShellVariable) (sourceText string, err error) {
+	credentialsPath, err := client.getVerifiedClusterCredentialsPath(account, name, customPath)
+	if err != nil {
+		return "", err
+	}
+
 	shellScriptPath, err := getCredentialScriptPath(credentialsPath, shell)
 	if err != nil {
 		return "", err
 	}
 
-	sourceText = sourceHelpString(shellScriptPath, name, shell)
+	sourceText = sourceHelpString(shellScriptPath, name, shell, variables)
 	return sourceText, nil
 }
 
@@ -193,6 +359,32 @@ func (client *Client) ListClusters(account Account) ([]common.Cluster, error) {
 	return clusters, wrapClientError(err)
 }
 
+// AccountClusters is the result of listing the clusters on a single account
+type AccountClusters struct {
+	Account  Account
+	Clusters []common.Cluster
+	Error    error
+}
+
+// ListClustersForAccounts retrieves the clusters on multiple accounts concurrently.
+// A failure on one account does not prevent the clusters on the other accounts from being retrieved.
+func (client *Client) ListClustersForAccounts(accounts []Account) []AccountClusters {
+	results := make([]AccountClusters, len(accounts))
+
+	var wg sync.WaitGroup
+	for i, account := range accounts {
+		wg.Add(1)
+		go func(i int, account Account) {
+			defer wg.Done()
+			clusters, err := client.ListClusters(account)
+			results[i] = AccountClusters{Account: account, Clusters: clusters, Error: err}
+		}(i, account)
+	}
+	wg.Wait()
+
+	return results
+}
+
 // ListClusterTemplates retrieves available templates for creating a new cluster
 func (client *Client) ListClusterTemplates(account Account, nameFilter string) ([]common.ClusterTemplate, error) {
 	defer client.Cache.SaveAccount(account)
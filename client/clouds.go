@@ -0,0 +1,193 @@
+package client
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// OpenStackCloudsFileEnvVar overrides the location of clouds.yaml
+const OpenStackCloudsFileEnvVar = "OS_CLIENT_CONFIG_FILE"
+
+// OpenStackSecureFileEnvVar overrides the location of secure.yaml
+const OpenStackSecureFileEnvVar = "OS_CLIENT_SECURE_FILE"
+
+// CloudConfig is a cloud defined in an OpenStack clouds.yaml file, shared with the openstack cli
+type CloudConfig struct {
+	Auth struct {
+		AuthURL           string `yaml:"auth_url"`
+		Username          string `yaml:"username"`
+		Password          string `yaml:"password"`
+		ProjectName       string `yaml:"project_name"`
+		TenantName        string `yaml:"tenant_name"`
+		DomainName        string `yaml:"domain_name"`
+		UserDomainName    string `yaml:"user_domain_name"`
+		ProjectDomainName string `yaml:"project_domain_name"`
+
+		UserID                      string `yaml:"user_id"`
+		ProjectID                   string `yaml:"project_id"`
+		UserDomainID                string `yaml:"user_domain_id"`
+		ProjectDomainID             string `yaml:"project_domain_id"`
+		ApplicationCredentialID     string `yaml:"application_credential_id"`
+		ApplicationCredentialSecret string `yaml:"application_credential_secret"`
+		Token                       string `yaml:"token"`
+	} `yaml:"auth"`
+	RegionName string `yaml:"region_name"`
+	Interface  string `yaml:"interface"`
+	CACert     string `yaml:"cacert"`
+	Cert       string `yaml:"cert"`
+	Key        string `yaml:"key"`
+
+	// Verify is false when TLS certificate verification is disabled
+	Verify *bool `yaml:"verify"`
+
+	// Source is the clouds.yaml file which defined the cloud
+	Source string `yaml:"-"`
+}
+
+// Project returns the project name, falling back to the legacy tenant name
+func (cloud *CloudConfig) Project() string {
+	if cloud.Auth.ProjectName != "" {
+		return cloud.Auth.ProjectName
+	}
+	return cloud.Auth.TenantName
+}
+
+// Domain returns the project domain, falling back to the user domain and then the domain
+func (cloud *CloudConfig) Domain() string {
+	switch {
+	case cloud.Auth.ProjectDomainName != "":
+		return cloud.Auth.ProjectDomainName
+	case cloud.Auth.UserDomainName != "":
+		return cloud.Auth.UserDomainName
+	default:
+		return cloud.Auth.DomainName
+	}
+}
+
+// LoadCloudConfig reads a cloud from clouds.yaml, merged with its secrets from secure.yaml
+func LoadCloudConfig(name string) (*CloudConfig, error) {
+	cloudsFile := findCloudConfigFile("clouds", OpenStackCloudsFileEnvVar)
+	if cloudsFile == "" {
+		return nil, fmt.Errorf("Unable to find clouds.yaml, searched %s. Set %s to its location", strings.Join(cloudConfigDirs(), ", "), OpenStackCloudsFileEnvVar)
+	}
+
+	clouds, err := readCloudConfigFile(cloudsFile)
+	if err != nil {
+		return nil, err
+	}
+
+	cloud, ok := clouds[name]
+	if !ok {
+		return nil, fmt.Errorf("Cloud %s not found in %s", name, cloudsFile)
+	}
+
+	secureFile := findCloudConfigFile("secure", OpenStackSecureFileEnvVar)
+	if secureFile != "" {
+		secrets, err := readCloudConfigFile(secureFile)
+		if err != nil {
+			return nil, err
+		}
+		if secret, ok := secrets[name]; ok {
+			cloud = mergeCloudConfig(cloud, secret)
+		}
+	}
+
+	// Round-trip the merged cloud through yaml to decode it
+	contents, err := yaml.Marshal(cloud)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to read cloud %s", name)
+	}
+	config := &CloudConfig{Source: cloudsFile}
+	err = yaml.Unmarshal(contents, config)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Invalid cloud %s in %s", name, cloudsFile)
+	}
+
+	return config, nil
+}
+
+// cloudConfigDirs returns the directories searched for clouds.yaml and secure.yaml, in order
+func cloudConfigDirs() []string {
+	dirs := []string{"."}
+
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if configHome == "" {
+		if home, err := userHomeDir(); err == nil {
+			configHome = filepath.Join(home, ".config")
+		}
+	}
+	if configHome != "" {
+		dirs = append(dirs, filepath.Join(configHome, "openstack"))
+	}
+
+	if runtime.GOOS != "windows" {
+		dirs = append(dirs, "/etc/openstack")
+	}
+
+	return dirs
+}
+
+// findCloudConfigFile returns the first name.yaml or name.yml found, or the file specified by the environment variable
+func findCloudConfigFile(name string, envVar string) string {
+	if path := os.Getenv(envVar); path != "" {
+		return path
+	}
+
+	for _, dir := range cloudConfigDirs() {
+		for _, ext := range []string{".yaml", ".yml"} {
+			path := filepath.Join(dir, name+ext)
+			if _, err := os.Stat(path); err == nil {
+				return path
+			}
+		}
+	}
+
+	return ""
+}
+
+func readCloudConfigFile(path string) (map[string]interface{}, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to read %s", path)
+	}
+
+	var file struct {
+		Clouds map[string]interface{} `yaml:"clouds"`
+	}
+	err = yaml.Unmarshal(contents, &file)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Invalid yaml in %s", path)
+	}
+
+	return file.Clouds, nil
+}
+
+// mergeCloudConfig merges the values from secure.yaml into a cloud, recursing into nested sections such as auth
+func mergeCloudConfig(cloud interface{}, secret interface{}) interface{} {
+	cloudMap, isMap := cloud.(map[interface{}]interface{})
+	secretMap, isSecretMap := secret.(map[interface{}]interface{})
+	if !isMap || !isSecretMap {
+		return secret
+	}
+
+	merged := make(map[interface{}]interface{}, len(cloudMap)+len(secretMap))
+	for key, value := range cloudMap {
+		merged[key] = value
+	}
+	for key, value := range secretMap {
+		if existing, ok := merged[key]; ok {
+			merged[key] = mergeCloudConfig(existing, value)
+		} else {
+			merged[key] = value
+		}
+	}
+
+	return merged
+}
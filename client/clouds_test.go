@@ -0,0 +1,114 @@
+package client
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testCloudsYAML = `
+clouds:
+  dev:
+    auth:
+      auth_url: https://identity.example.com/v3
+      username: alicia
+      project_name: admin
+      user_domain_name: users
+      project_domain_name: projects
+    region_name: RegionTwo
+    interface: internal
+    cacert: /etc/ssl/dev.pem
+  prod:
+    auth:
+      auth_url: https://identity.example.com/v3
+      username: bob
+      password: plaintext
+      tenant_name: legacy
+`
+
+const testSecureYAML = `
+clouds:
+  dev:
+    auth:
+      password: ilovepuppies
+`
+
+func TestLoadCloudConfigMergesSecureFile(t *testing.T) {
+	restore := writeCloudConfigFiles(t, testCloudsYAML, testSecureYAML)
+	defer restore()
+
+	cloud, err := LoadCloudConfig("dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cloud.Auth.AuthURL != "https://identity.example.com/v3" || cloud.Auth.Username != "alicia" {
+		t.Errorf("Expected the auth section from clouds.yaml, got %+v", cloud.Auth)
+	}
+	if cloud.Auth.Password != "ilovepuppies" {
+		t.Errorf("Expected the password from secure.yaml, got %s", cloud.Auth.Password)
+	}
+	if cloud.Project() != "admin" || cloud.Domain() != "projects" {
+		t.Errorf("Expected the project admin in domain projects, got %s in %s", cloud.Project(), cloud.Domain())
+	}
+	if cloud.RegionName != "RegionTwo" || cloud.Interface != "internal" || cloud.CACert != "/etc/ssl/dev.pem" {
+		t.Errorf("Expected the region, interface and cacert to be read, got %+v", cloud)
+	}
+}
+
+func TestLoadCloudConfigWithoutSecureFile(t *testing.T) {
+	restore := writeCloudConfigFiles(t, testCloudsYAML, "")
+	defer restore()
+
+	cloud, err := LoadCloudConfig("prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cloud.Auth.Password != "plaintext" || cloud.Project() != "legacy" {
+		t.Errorf("Expected the password and legacy tenant name, got %+v", cloud.Auth)
+	}
+
+	_, err = LoadCloudConfig("missing")
+	if err == nil {
+		t.Error("Expected an error for an unknown cloud")
+	}
+}
+
+// writeCloudConfigFiles points OS_CLIENT_CONFIG_FILE and OS_CLIENT_SECURE_FILE at temporary files, until restore is called
+func writeCloudConfigFiles(t *testing.T, clouds string, secure string) (restore func()) {
+	dir, err := ioutil.TempDir("", "carina-clouds")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	envVars := []string{OpenStackCloudsFileEnvVar, OpenStackSecureFileEnvVar}
+	original := make(map[string]string, len(envVars))
+	for _, envVar := range envVars {
+		original[envVar] = os.Getenv(envVar)
+	}
+	restore = func() {
+		for envVar, value := range original {
+			if value == "" {
+				os.Unsetenv(envVar)
+			} else {
+				os.Setenv(envVar, value)
+			}
+		}
+		os.RemoveAll(dir)
+	}
+
+	cloudsFile := filepath.Join(dir, "clouds.yaml")
+	ioutil.WriteFile(cloudsFile, []byte(clouds), 0600)
+	os.Setenv(OpenStackCloudsFileEnvVar, cloudsFile)
+
+	if secure == "" {
+		os.Unsetenv(OpenStackSecureFileEnvVar)
+		return restore
+	}
+	secureFile := filepath.Join(dir, "secure.yaml")
+	ioutil.WriteFile(secureFile, []byte(secure), 0600)
+	os.Setenv(OpenStackSecureFileEnvVar, secureFile)
+
+	return restore
+}
@@ -0,0 +1,144 @@
+package client
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/getcarina/carina/common"
+	"github.com/pkg/errors"
+)
+
+// completionCacheTTL is how long cluster and template names are reused for shell completion.
+// It is kept short so that completion doesn't hit the network on every keystroke, without going noticeably stale.
+const completionCacheTTL = time.Minute
+
+type completionItem struct {
+	Names     []string  `json:"names"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+func (item completionItem) isFresh() bool {
+	return time.Since(item.Timestamp) < completionCacheTTL
+}
+
+// completionCache is a short-lived on-disk cache of cluster and template names, stored next to the main cache
+type completionCache struct {
+	path      string
+	Clusters  map[string]completionItem `json:"clusters"`
+	Templates map[string]completionItem `json:"templates"`
+}
+
+func newCompletionCache(cache *Cache) *completionCache {
+	completion := &completionCache{
+		Clusters:  make(map[string]completionItem),
+		Templates: make(map[string]completionItem),
+	}
+
+	// The completion cache is disabled along with the main cache
+	if !cache.isNil() {
+		completion.path = filepath.Join(filepath.Dir(cache.path), "completion.json")
+	}
+
+	return completion
+}
+
+func (cache *completionCache) load() {
+	if cache.path == "" {
+		return
+	}
+
+	f, err := os.Open(cache.path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	err = json.NewDecoder(f).Decode(cache)
+	if err != nil {
+		common.Log.WriteDebug(errors.Wrap(err, "Unable to deserialize the completion cache, ignoring it").Error())
+	}
+
+	if cache.Clusters == nil {
+		cache.Clusters = make(map[string]completionItem)
+	}
+	if cache.Templates == nil {
+		cache.Templates = make(map[string]completionItem)
+	}
+}
+
+func (cache *completionCache) save() error {
+	if cache.path == "" {
+		return nil
+	}
+
+	contents, err := json.Marshal(cache)
+	if err != nil {
+		return errors.Wrap(err, "Cannot serialize the completion cache")
+	}
+
+	return errors.Wrap(WriteFileAtomic(cache.path, contents, 0600), "Cannot write the completion cache")
+}
+
+// getNames returns the cached names for the account, refreshing them with fetch when they are stale
+func (cache *completionCache) getNames(selectItems func(*completionCache) map[string]completionItem, account Account, fetch func() ([]string, error)) ([]string, error) {
+	cache.load()
+	items := selectItems(cache)
+	id := account.GetID()
+	if item, ok := items[id]; ok && item.isFresh() {
+		common.Log.WriteDebug("Using cached completion names for %s", id)
+		return item.Names, nil
+	}
+
+	names, err := fetch()
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+
+	items[id] = completionItem{Names: names, Timestamp: time.Now()}
+	err = cache.save()
+	if err != nil {
+		common.Log.WriteDebug(err.Error())
+	}
+
+	return names, nil
+}
+
+// ListClusterNames retrieves the cluster names for shell completion, reusing recent results
+func (client *Client) ListClusterNames(account Account) ([]string, error) {
+	completion := newCompletionCache(client.Cache)
+	clusters := func(c *completionCache) map[string]completionItem { return c.Clusters }
+	return completion.getNames(clusters, account, func() ([]string, error) {
+		clusters, err := client.ListClusters(account)
+		if err != nil {
+			return nil, err
+		}
+
+		var names []string
+		for _, cluster := range clusters {
+			names = append(names, cluster.GetName())
+		}
+		return names, nil
+	})
+}
+
+// ListClusterTemplateNames retrieves the cluster template names for shell completion, reusing recent results
+func (client *Client) ListClusterTemplateNames(account Account) ([]string, error) {
+	completion := newCompletionCache(client.Cache)
+	templates := func(c *completionCache) map[string]completionItem { return c.Templates }
+	return completion.getNames(templates, account, func() ([]string, error) {
+		templates, err := client.ListClusterTemplates(account, "")
+		if err != nil {
+			return nil, err
+		}
+
+		var names []string
+		for _, template := range templates {
+			names = append(names, template.GetName())
+		}
+		return names, nil
+	})
+}
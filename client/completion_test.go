@@ -0,0 +1,63 @@
+package client
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompletionCacheReusesFreshNames(t *testing.T) {
+	dir, err := ioutil.TempDir("", "carina-completion")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	account := &stubAccount{id: "dev-user"}
+	cache := newCache(filepath.Join(dir, "cache.json"))
+	clusters := func(c *completionCache) map[string]completionItem { return c.Clusters }
+
+	fetches := 0
+	fetch := func() ([]string, error) {
+		fetches++
+		return []string{"prod", "dev"}, nil
+	}
+
+	names, err := newCompletionCache(cache).getNames(clusters, account, fetch)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"dev", "prod"}, names)
+
+	names, err = newCompletionCache(cache).getNames(clusters, account, fetch)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"dev", "prod"}, names)
+	assert.Equal(t, 1, fetches, "The second lookup should be served from completion.json")
+
+	// Expire the cached names
+	completion := newCompletionCache(cache)
+	completion.load()
+	item := completion.Clusters[account.GetID()]
+	item.Timestamp = time.Now().Add(-2 * completionCacheTTL)
+	completion.Clusters[account.GetID()] = item
+	assert.Nil(t, completion.save())
+
+	_, err = newCompletionCache(cache).getNames(clusters, account, fetch)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, fetches, "Stale names should be refreshed")
+}
+
+func TestCompletionCacheDisabledWithCache(t *testing.T) {
+	account := &stubAccount{id: "dev-user"}
+	clusters := func(c *completionCache) map[string]completionItem { return c.Clusters }
+
+	completion := newCompletionCache(&Cache{})
+	_, err := completion.getNames(clusters, account, func() ([]string, error) {
+		return nil, errors.New("offline")
+	})
+	assert.NotNil(t, err)
+	assert.Equal(t, "", completion.path)
+}
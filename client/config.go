@@ -0,0 +1,138 @@
+package client
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/getcarina/carina/common"
+	"github.com/pkg/errors"
+)
+
+// CarinaConfigEnvVar is the environment variable name for the config file
+const CarinaConfigEnvVar = "CARINA_CONFIG"
+
+const xdgConfigHomeEnvVar = "XDG_CONFIG_HOME"
+const configFileName = "config"
+
+// ConfigFileExtensions are the supported config file formats, in the order that they are searched
+var ConfigFileExtensions = []string{".toml", ".yaml", ".yml", ".json"}
+
+// GetConfigDirs returns the directories searched for the config file, in order:
+// CARINA_HOME, $XDG_CONFIG_HOME/carina, then ~/.carina
+func GetConfigDirs() ([]string, error) {
+	var dirs []string
+	if carinaHome := os.Getenv(CarinaHomeDirEnvVar); carinaHome != "" {
+		dirs = append(dirs, filepath.Clean(carinaHome))
+	}
+	if xdgConfigHome := os.Getenv(xdgConfigHomeEnvVar); xdgConfigHome != "" {
+		dirs = append(dirs, filepath.Join(xdgConfigHome, defaultNonDotDir))
+	}
+
+	legacyDir, err := getLegacyConfigDir()
+	if err != nil {
+		if len(dirs) == 0 {
+			return nil, errors.New("Unable to default the config directory to ~/.carina. Set the CARINA_HOME or CARINA_CONFIG environment variable")
+		}
+		return dirs, nil
+	}
+
+	for _, dir := range dirs {
+		if dir == legacyDir {
+			return dirs, nil
+		}
+	}
+	return append(dirs, legacyDir), nil
+}
+
+// GetConfigDir returns the directory where a new config file is created, the first of GetConfigDirs
+func GetConfigDir() (string, error) {
+	dirs, err := GetConfigDirs()
+	if err != nil {
+		return "", err
+	}
+	return dirs[0], nil
+}
+
+// FindConfigFile returns the config file set by CARINA_CONFIG, or the first config file found in the config directories.
+// An empty path is returned when there is no config file.
+func FindConfigFile() (string, error) {
+	if configFile := os.Getenv(CarinaConfigEnvVar); configFile != "" {
+		common.Log.WriteDebug("Config: %s", CarinaConfigEnvVar)
+		return configFile, nil
+	}
+
+	dirs, err := GetConfigDirs()
+	if err != nil {
+		return "", err
+	}
+
+	for _, dir := range dirs {
+		if configFile := findConfigFileInDir(dir); configFile != "" {
+			return configFile, nil
+		}
+	}
+
+	return "", nil
+}
+
+// findConfigFileInDir returns the first config.[toml|yaml|yml|json] in a directory
+func findConfigFileInDir(dir string) string {
+	for _, ext := range ConfigFileExtensions {
+		path := filepath.Join(dir, configFileName+ext)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// MigrateConfigFile copies a config file found only in ~/.carina to the preferred config directory,
+// when CARINA_HOME or XDG_CONFIG_HOME is set. The original is kept, for shells where neither is set.
+// The path of the copied config file is returned, or an empty path when there was nothing to migrate.
+func MigrateConfigFile() (string, error) {
+	if os.Getenv(CarinaConfigEnvVar) != "" {
+		return "", nil
+	}
+
+	dirs, err := GetConfigDirs()
+	if err != nil {
+		return "", err
+	}
+	legacyDir, err := getLegacyConfigDir()
+	if err != nil || dirs[0] == legacyDir {
+		return "", nil
+	}
+
+	configFile, err := FindConfigFile()
+	if err != nil || configFile == "" || filepath.Dir(configFile) != legacyDir {
+		return "", err
+	}
+
+	migratedFile := filepath.Join(dirs[0], filepath.Base(configFile))
+	contents, err := ioutil.ReadFile(configFile)
+	if err != nil {
+		return "", errors.Wrapf(err, "Unable to read the config file %s", configFile)
+	}
+
+	err = os.MkdirAll(dirs[0], 0700)
+	if err == nil {
+		err = WriteFileAtomic(migratedFile, contents, 0600)
+	}
+	if err != nil {
+		return "", errors.Wrapf(err, "Unable to migrate the config file %s to %s", configFile, dirs[0])
+	}
+
+	common.Log.WriteWarning("Copied the config file %s to %s, which is used from now on when %s or %s is set. The original is used otherwise.",
+		configFile, migratedFile, CarinaHomeDirEnvVar, xdgConfigHomeEnvVar)
+	return migratedFile, nil
+}
+
+// getLegacyConfigDir returns ~/.carina, where the config file was always read from in earlier releases
+func getLegacyConfigDir() (string, error) {
+	homeDir, err := userHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(homeDir, defaultDotDir), nil
+}
@@ -0,0 +1,185 @@
+package client
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFindConfigFileSearchOrder(t *testing.T) {
+	root, restore := setConfigTestEnv(t)
+	defer restore()
+
+	writeTestConfigFile(t, filepath.Join(root, "home", ".carina", "config.toml"), "[default]\n")
+	writeTestConfigFile(t, filepath.Join(root, "xdg", "carina", "config.yaml"), "default: {}\n")
+	writeTestConfigFile(t, filepath.Join(root, "carina-home", "config.json"), "{}\n")
+
+	configFile, err := FindConfigFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if configFile != filepath.Join(root, "carina-home", "config.json") {
+		t.Errorf("Expected the config file in CARINA_HOME, got %s", configFile)
+	}
+
+	os.Unsetenv(CarinaHomeDirEnvVar)
+	configFile, err = FindConfigFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if configFile != filepath.Join(root, "xdg", "carina", "config.yaml") {
+		t.Errorf("Expected the config file in XDG_CONFIG_HOME, got %s", configFile)
+	}
+
+	os.Setenv(CarinaConfigEnvVar, filepath.Join(root, "custom.toml"))
+	configFile, err = FindConfigFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if configFile != filepath.Join(root, "custom.toml") {
+		t.Errorf("Expected the config file from CARINA_CONFIG, got %s", configFile)
+	}
+}
+
+func TestFindConfigFileDoesNotMigrateLegacyConfig(t *testing.T) {
+	root, restore := setConfigTestEnv(t)
+	defer restore()
+
+	legacyFile := filepath.Join(root, "home", ".carina", "config.toml")
+	writeTestConfigFile(t, legacyFile, "[default]\ncloud=\"public\"\n")
+
+	configFile, err := FindConfigFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if configFile != legacyFile {
+		t.Errorf("Expected the config file in ~/.carina, got %s", configFile)
+	}
+	if _, err := os.Stat(filepath.Join(root, "carina-home", "config.toml")); err == nil {
+		t.Error("Expected finding the config file to leave it in place")
+	}
+}
+
+func TestMigrateConfigFile(t *testing.T) {
+	root, restore := setConfigTestEnv(t)
+	defer restore()
+
+	legacyFile := filepath.Join(root, "home", ".carina", "config.toml")
+	writeTestConfigFile(t, legacyFile, "[default]\ncloud=\"public\"\n")
+
+	migratedFile, err := MigrateConfigFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedFile := filepath.Join(root, "carina-home", "config.toml")
+	if migratedFile != expectedFile {
+		t.Fatalf("Expected the config file to be migrated to %s, got %s", expectedFile, migratedFile)
+	}
+
+	contents, err := ioutil.ReadFile(migratedFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(contents) != "[default]\ncloud=\"public\"\n" {
+		t.Errorf("Expected the migrated config file to match the original, got %q", string(contents))
+	}
+	if _, err := os.Stat(legacyFile); err != nil {
+		t.Errorf("Expected the original config file to be kept, got %s", err)
+	}
+
+	configFile, err := FindConfigFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if configFile != migratedFile {
+		t.Errorf("Expected the migrated config file to be found, got %s", configFile)
+	}
+
+	migratedFile, err = MigrateConfigFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if migratedFile != "" {
+		t.Errorf("Expected the config file to be migrated once, got %s", migratedFile)
+	}
+}
+
+func TestMigrateConfigFileWithoutConfigHome(t *testing.T) {
+	root, restore := setConfigTestEnv(t)
+	defer restore()
+	os.Unsetenv(CarinaHomeDirEnvVar)
+	os.Unsetenv(xdgConfigHomeEnvVar)
+
+	legacyFile := filepath.Join(root, "home", ".carina", "config.toml")
+	writeTestConfigFile(t, legacyFile, "[default]\n")
+
+	migratedFile, err := MigrateConfigFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if migratedFile != "" {
+		t.Errorf("Expected the config file to be left in ~/.carina, got %s", migratedFile)
+	}
+	if _, err := os.Stat(legacyFile); err != nil {
+		t.Errorf("Expected the config file to be kept, got %s", err)
+	}
+}
+
+func TestFindConfigFileWithoutConfig(t *testing.T) {
+	_, restore := setConfigTestEnv(t)
+	defer restore()
+
+	configFile, err := FindConfigFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if configFile != "" {
+		t.Errorf("Expected no config file, got %s", configFile)
+	}
+}
+
+// setConfigTestEnv points HOME, CARINA_HOME and XDG_CONFIG_HOME at a temporary directory, until restore is called.
+// CARINA_CONFIG, KUBECONFIG and DOCKER_CONFIG are unset, so that the defaults in HOME are used.
+func setConfigTestEnv(t *testing.T) (root string, restore func()) {
+	root, err := ioutil.TempDir("", "carina-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	envVars := []string{CarinaConfigEnvVar, "HOME", CarinaHomeDirEnvVar, xdgConfigHomeEnvVar, kubeConfigEnvVar, dockerConfigEnvVar}
+	original := make(map[string]string, len(envVars))
+	for _, envVar := range envVars {
+		original[envVar] = os.Getenv(envVar)
+	}
+	restore = func() {
+		for envVar, value := range original {
+			if value == "" {
+				os.Unsetenv(envVar)
+			} else {
+				os.Setenv(envVar, value)
+			}
+		}
+		os.RemoveAll(root)
+	}
+
+	os.Unsetenv(CarinaConfigEnvVar)
+	os.Unsetenv(kubeConfigEnvVar)
+	os.Unsetenv(dockerConfigEnvVar)
+	os.Setenv("HOME", filepath.Join(root, "home"))
+	os.Setenv(CarinaHomeDirEnvVar, filepath.Join(root, "carina-home"))
+	os.Setenv(xdgConfigHomeEnvVar, filepath.Join(root, "xdg"))
+
+	return root, restore
+}
+
+func writeTestConfigFile(t *testing.T, path string, contents string) {
+	err := os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(path, []byte(contents), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,319 @@
+package client
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/getcarina/carina/common"
+	"github.com/getcarina/libcarina"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+const kubeConfigEnvVar = "KUBECONFIG"
+const dockerConfigEnvVar = "DOCKER_CONFIG"
+
+var dockerHostPattern = regexp.MustCompile(`DOCKER_HOST=["']?([^"'\s]+)`)
+
+// updateClusterContexts points the kubeconfig and docker context entries for a cluster at its new credentials.
+// Entries are matched on the cluster's API endpoint, and a description of each updated entry is returned.
+func updateClusterContexts(credentialsPath string, creds *libcarina.CredentialsBundle) ([]string, error) {
+	credentialsPath, err := filepath.Abs(credentialsPath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to resolve the credentials path %s", credentialsPath)
+	}
+
+	var updated []string
+	if kubeConfig, ok := creds.Files["kubectl.config"]; ok {
+		entries, err := updateKubeConfigs(credentialsPath, kubeConfig)
+		updated = append(updated, entries...)
+		if err != nil {
+			return updated, err
+		}
+	}
+
+	if dockerEnv, ok := creds.Files["docker.env"]; ok {
+		match := dockerHostPattern.FindSubmatch(dockerEnv)
+		if match != nil {
+			entries, err := updateDockerContexts(credentialsPath, string(match[1]))
+			updated = append(updated, entries...)
+			if err != nil {
+				return updated, err
+			}
+		}
+	}
+
+	return updated, nil
+}
+
+// kubeCredentials are the server and certificate files from the kubeconfig in a credentials bundle
+type kubeCredentials struct {
+	Server string
+	CA     string
+	Cert   string
+	Key    string
+}
+
+// updateKubeConfigs updates the clusters and users for the cluster's server in the user's kubeconfig files
+func updateKubeConfigs(credentialsPath string, bundleConfig []byte) ([]string, error) {
+	var bundle yaml.MapSlice
+	err := yaml.Unmarshal(bundleConfig, &bundle)
+	if err != nil {
+		return nil, errors.Wrap(err, "Unable to parse the kubeconfig in the credentials bundle")
+	}
+
+	creds := kubeCredentials{}
+	for _, item := range getYAMLList(bundle, "clusters") {
+		cluster := getYAMLMap(item, "cluster")
+		creds.Server = getYAMLString(cluster, "server")
+		creds.CA = resolveBundlePath(credentialsPath, getYAMLString(cluster, "certificate-authority"))
+	}
+	for _, item := range getYAMLList(bundle, "users") {
+		user := getYAMLMap(item, "user")
+		creds.Cert = resolveBundlePath(credentialsPath, getYAMLString(user, "client-certificate"))
+		creds.Key = resolveBundlePath(credentialsPath, getYAMLString(user, "client-key"))
+	}
+	if creds.Server == "" {
+		return nil, nil
+	}
+
+	var updated []string
+	for _, kubeConfigFile := range findKubeConfigFiles() {
+		// Skip the kubeconfig in the bundle, and any other bundles in the same directory
+		if isInDir(kubeConfigFile, credentialsPath) {
+			continue
+		}
+
+		entries, err := updateKubeConfig(kubeConfigFile, creds)
+		updated = append(updated, entries...)
+		if err != nil {
+			return updated, err
+		}
+	}
+	return updated, nil
+}
+
+// findKubeConfigFiles returns the kubeconfig files used by kubectl, from KUBECONFIG or ~/.kube/config
+func findKubeConfigFiles() []string {
+	if kubeConfig := os.Getenv(kubeConfigEnvVar); kubeConfig != "" {
+		var files []string
+		for _, file := range filepath.SplitList(kubeConfig) {
+			if file != "" {
+				files = append(files, file)
+			}
+		}
+		return files
+	}
+
+	homeDir, err := userHomeDir()
+	if err != nil {
+		return nil
+	}
+	return []string{filepath.Join(homeDir, ".kube", "config")}
+}
+
+// updateKubeConfig updates a kubeconfig file in place, replacing the certificates of clusters using the server,
+// and of the users in contexts for those clusters
+func updateKubeConfig(kubeConfigFile string, creds kubeCredentials) ([]string, error) {
+	info, err := os.Stat(kubeConfigFile)
+	if err != nil {
+		return nil, nil
+	}
+	contents, err := ioutil.ReadFile(kubeConfigFile)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to read the kubeconfig %s", kubeConfigFile)
+	}
+
+	var config yaml.MapSlice
+	err = yaml.Unmarshal(contents, &config)
+	if err != nil {
+		common.Log.WriteWarning("Skipping the kubeconfig %s because it could not be parsed: %s", kubeConfigFile, err)
+		return nil, nil
+	}
+
+	var updated []string
+	clusterNames := make(map[string]bool)
+	for _, item := range getYAMLList(config, "clusters") {
+		cluster := getYAMLMap(item, "cluster")
+		if getYAMLString(cluster, "server") != creds.Server {
+			continue
+		}
+
+		name := getYAMLString(item, "name")
+		clusterNames[name] = true
+		err = setKubeCertificate(cluster, "certificate-authority", creds.CA)
+		if err != nil {
+			return nil, err
+		}
+		updated = append(updated, fmt.Sprintf("kubeconfig cluster %s in %s", name, kubeConfigFile))
+	}
+	if len(clusterNames) == 0 {
+		return nil, nil
+	}
+
+	userNames := make(map[string]bool)
+	for _, item := range getYAMLList(config, "contexts") {
+		context := getYAMLMap(item, "context")
+		if clusterNames[getYAMLString(context, "cluster")] {
+			userNames[getYAMLString(context, "user")] = true
+		}
+	}
+	for _, item := range getYAMLList(config, "users") {
+		name := getYAMLString(item, "name")
+		if !userNames[name] {
+			continue
+		}
+
+		user := getYAMLMap(item, "user")
+		err = setKubeCertificate(user, "client-certificate", creds.Cert)
+		if err == nil {
+			err = setKubeCertificate(user, "client-key", creds.Key)
+		}
+		if err != nil {
+			return nil, err
+		}
+		updated = append(updated, fmt.Sprintf("kubeconfig user %s in %s", name, kubeConfigFile))
+	}
+
+	contents, err = yaml.Marshal(config)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to update the kubeconfig %s", kubeConfigFile)
+	}
+	err = WriteFileAtomic(kubeConfigFile, contents, info.Mode().Perm())
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// setKubeCertificate replaces a certificate in a kubeconfig entry. Embedded certificates, e.g. certificate-authority-data,
+// are replaced with the new file's contents, otherwise the entry is pointed at the new file.
+// Entries which don't use the certificate are left as is.
+func setKubeCertificate(entry yaml.MapSlice, key string, path string) error {
+	if entry == nil || path == "" {
+		return nil
+	}
+
+	if getYAMLValue(entry, key+"-data") != nil {
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			return errors.Wrapf(err, "Unable to read %s", path)
+		}
+		setYAMLValue(entry, key+"-data", base64.StdEncoding.EncodeToString(contents))
+		return nil
+	}
+
+	setYAMLValue(entry, key, path)
+	return nil
+}
+
+// updateDockerContexts replaces the TLS files of docker contexts using the docker host
+func updateDockerContexts(credentialsPath string, host string) ([]string, error) {
+	configDir := os.Getenv(dockerConfigEnvVar)
+	if configDir == "" {
+		homeDir, err := userHomeDir()
+		if err != nil {
+			return nil, nil
+		}
+		configDir = filepath.Join(homeDir, ".docker")
+	}
+
+	metaFiles, _ := filepath.Glob(filepath.Join(configDir, "contexts", "meta", "*", "meta.json"))
+	var updated []string
+	for _, metaFile := range metaFiles {
+		contents, err := ioutil.ReadFile(metaFile)
+		if err != nil {
+			continue
+		}
+
+		var meta struct {
+			Name      string
+			Endpoints map[string]struct {
+				Host string
+			}
+		}
+		err = json.Unmarshal(contents, &meta)
+		if err != nil || meta.Endpoints["docker"].Host != host {
+			continue
+		}
+
+		contextID := filepath.Base(filepath.Dir(metaFile))
+		tlsDir := filepath.Join(configDir, "contexts", "tls", contextID, "docker")
+		err = os.MkdirAll(tlsDir, 0700)
+		if err != nil {
+			return updated, errors.Wrapf(err, "Unable to update the docker context %s", meta.Name)
+		}
+		for _, file := range []string{"ca.pem", "cert.pem", "key.pem"} {
+			tlsFile, err := ioutil.ReadFile(filepath.Join(credentialsPath, file))
+			if err != nil {
+				return updated, errors.Wrapf(err, "Unable to update the docker context %s", meta.Name)
+			}
+			err = WriteFileAtomic(filepath.Join(tlsDir, file), tlsFile, 0600)
+			if err != nil {
+				return updated, errors.Wrapf(err, "Unable to update the docker context %s", meta.Name)
+			}
+		}
+		updated = append(updated, fmt.Sprintf("docker context %s", meta.Name))
+	}
+	return updated, nil
+}
+
+// resolveBundlePath resolves a file referenced by the kubeconfig in a credentials bundle
+func resolveBundlePath(credentialsPath string, path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(credentialsPath, path)
+}
+
+// isInDir checks if a file is in the directory
+func isInDir(path string, dir string) bool {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	return strings.HasPrefix(path, dir+string(filepath.Separator))
+}
+
+func getYAMLValue(m yaml.MapSlice, key string) interface{} {
+	for _, item := range m {
+		if item.Key == key {
+			return item.Value
+		}
+	}
+	return nil
+}
+
+// setYAMLValue replaces the value of an existing key in place, so that the parent document sees the change.
+// Missing keys are left unset.
+func setYAMLValue(m yaml.MapSlice, key string, value interface{}) {
+	for i := range m {
+		if m[i].Key == key {
+			m[i].Value = value
+			return
+		}
+	}
+}
+
+func getYAMLMap(value interface{}, key string) yaml.MapSlice {
+	m, _ := value.(yaml.MapSlice)
+	child, _ := getYAMLValue(m, key).(yaml.MapSlice)
+	return child
+}
+
+func getYAMLList(m yaml.MapSlice, key string) []interface{} {
+	list, _ := getYAMLValue(m, key).([]interface{})
+	return list
+}
+
+func getYAMLString(value interface{}, key string) string {
+	m, _ := value.(yaml.MapSlice)
+	s, _ := getYAMLValue(m, key).(string)
+	return s
+}
@@ -0,0 +1,146 @@
+package client
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/getcarina/libcarina"
+)
+
+const testBundleKubeConfig = `apiVersion: v1
+clusters:
+- cluster:
+    certificate-authority: ca.pem
+    server: https://10.0.0.1:6443
+  name: cluster
+contexts:
+- context:
+    cluster: cluster
+    user: admin
+  name: default
+current-context: default
+kind: Config
+users:
+- name: admin
+  user:
+    client-certificate: cert.pem
+    client-key: key.pem
+`
+
+func TestUpdateClusterContexts(t *testing.T) {
+	root, restore := setConfigTestEnv(t)
+	defer restore()
+
+	credentialsPath := filepath.Join(root, "carina-home", "clusters", "mycluster")
+	creds := &libcarina.CredentialsBundle{Files: map[string][]byte{
+		"ca.pem":         []byte("new-ca"),
+		"cert.pem":       []byte("new-cert"),
+		"key.pem":        []byte("new-key"),
+		"kubectl.config": []byte(testBundleKubeConfig),
+		"docker.env":     []byte("export DOCKER_HOST=tcp://10.0.0.1:2376\n"),
+	}}
+	err := saveClusterCredentials(creds, credentialsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kubeConfigFile := filepath.Join(root, "home", ".kube", "config")
+	writeTestConfigFile(t, kubeConfigFile, `apiVersion: v1
+clusters:
+- cluster:
+    certificate-authority-data: b2xkLWNh
+    server: https://10.0.0.1:6443
+  name: mycluster
+- cluster:
+    certificate-authority: /other/ca.pem
+    server: https://10.0.0.2:6443
+  name: other
+contexts:
+- context:
+    cluster: mycluster
+    user: mycluster-admin
+  name: mycluster
+- context:
+    cluster: other
+    user: other-admin
+  name: other
+users:
+- name: mycluster-admin
+  user:
+    client-certificate: /old/cert.pem
+    client-key: /old/key.pem
+- name: other-admin
+  user:
+    client-certificate: /other/cert.pem
+    client-key: /other/key.pem
+`)
+
+	dockerConfigDir := filepath.Join(root, "home", ".docker")
+	writeTestConfigFile(t, filepath.Join(dockerConfigDir, "contexts", "meta", "abc123", "meta.json"),
+		`{"Name":"mycluster","Metadata":{},"Endpoints":{"docker":{"Host":"tcp://10.0.0.1:2376","SkipTLSVerify":false}}}`)
+	writeTestConfigFile(t, filepath.Join(dockerConfigDir, "contexts", "meta", "def456", "meta.json"),
+		`{"Name":"other","Metadata":{},"Endpoints":{"docker":{"Host":"tcp://10.0.0.2:2376","SkipTLSVerify":false}}}`)
+
+	updated, err := updateClusterContexts(credentialsPath, creds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(updated) != 3 {
+		t.Errorf("Expected the kubeconfig cluster and user, and the docker context to be updated, got %v", updated)
+	}
+
+	contents, err := ioutil.ReadFile(kubeConfigFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kubeConfig := string(contents)
+	expected := []string{
+		"certificate-authority-data: " + base64.StdEncoding.EncodeToString([]byte("new-ca")),
+		"client-certificate: " + filepath.Join(credentialsPath, "cert.pem"),
+		"client-key: " + filepath.Join(credentialsPath, "key.pem"),
+		"certificate-authority: /other/ca.pem",
+		"client-certificate: /other/cert.pem",
+	}
+	for _, line := range expected {
+		if !strings.Contains(kubeConfig, line) {
+			t.Errorf("Expected the kubeconfig to contain %q, got\n%s", line, kubeConfig)
+		}
+	}
+	if strings.Index(kubeConfig, "name: mycluster\n") > strings.Index(kubeConfig, "name: other\n") {
+		t.Errorf("Expected the order of the kubeconfig entries to be kept, got\n%s", kubeConfig)
+	}
+
+	cert, err := ioutil.ReadFile(filepath.Join(dockerConfigDir, "contexts", "tls", "abc123", "docker", "cert.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(cert) != "new-cert" {
+		t.Errorf("Expected the docker context certificate to be replaced, got %q", string(cert))
+	}
+	if _, err := os.Stat(filepath.Join(dockerConfigDir, "contexts", "tls", "def456")); err == nil {
+		t.Error("Expected the docker context for another host to be left as is")
+	}
+}
+
+func TestUpdateClusterContextsWithoutContexts(t *testing.T) {
+	root, restore := setConfigTestEnv(t)
+	defer restore()
+
+	credentialsPath := filepath.Join(root, "carina-home", "clusters", "mycluster")
+	creds := &libcarina.CredentialsBundle{Files: map[string][]byte{
+		"kubectl.config": []byte(testBundleKubeConfig),
+		"docker.env":     []byte("export DOCKER_HOST=tcp://10.0.0.1:2376\n"),
+	}}
+
+	updated, err := updateClusterContexts(credentialsPath, creds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(updated) != 0 {
+		t.Errorf("Expected nothing to be updated, got %v", updated)
+	}
+}
@@ -1,11 +1,16 @@
 package client
 
 import (
+	"crypto/x509"
+	"encoding/pem"
 	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
+
+	"github.com/getcarina/libcarina"
 )
 
 const clusterDirName = "clusters"
@@ -13,6 +18,20 @@ const defaultDotDir = ".carina"
 const defaultNonDotDir = "carina"
 const xdgDataHomeEnvVar = "XDG_DATA_HOME"
 
+// ShellVariable is an environment variable set in the user's shell when loading a cluster's credentials
+type ShellVariable struct {
+	Name  string
+	Value string
+}
+
+// posixExportCommand returns the bash command which sets the variable, or unsets it when the value is empty
+func posixExportCommand(variable ShellVariable) string {
+	if variable.Value == "" {
+		return "unset " + variable.Name
+	}
+	return fmt.Sprintf("export %s='%s'", variable.Name, strings.Replace(variable.Value, "'", `'\''`, -1))
+}
+
 // GetCredentialsDir gets the carina home directory, e.g. ~/.carina
 func GetCredentialsDir() (string, error) {
 	if os.Getenv(CarinaHomeDirEnvVar) != "" {
@@ -31,22 +50,50 @@ func GetCredentialsDir() (string, error) {
 	return filepath.Join(homeDir, defaultDotDir), nil
 }
 
+// GetClusterCredentialsDir gets the directory which holds the credentials of the account's clusters, e.g. ~/.carina/clusters/public-dfw-alicia
+func GetClusterCredentialsDir(account Account) (string, error) {
+	baseDir, err := GetCredentialsDir()
+	if err != nil {
+		return "", err
+	}
+
+	clusterPrefix, err := account.GetClusterPrefix()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(baseDir, clusterDirName, clusterPrefix), nil
+}
+
+// VerifyClusterCredentials checks that a credentials bundle is valid, and returns when its certificate expires.
+// The expiry is zero when it cannot be determined.
+func VerifyClusterCredentials(credentialsPath string) (time.Time, error) {
+	creds := libcarina.LoadCredentialsBundle(credentialsPath)
+	err := creds.Verify()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	block, _ := pem.Decode(creds.Files["cert.pem"])
+	if block == nil {
+		return time.Time{}, nil
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return time.Time{}, nil
+	}
+	return cert.NotAfter, nil
+}
+
 func buildClusterCredentialsPath(account Account, clusterName string, customPath string) (string, error) {
 	var credentialsPath string
 
 	// Use the default path, if the user didn't specify a special path where the credentials are stored
 	if customPath == "" {
-		var baseDir string
-		baseDir, err := GetCredentialsDir()
-		if err != nil {
-			return "", err
-		}
-
-		clusterPrefix, err := account.GetClusterPrefix()
+		clustersDir, err := GetClusterCredentialsDir(account)
 		if err != nil {
 			return "", err
 		}
-		credentialsPath = filepath.Join(baseDir, clusterDirName, clusterPrefix, clusterName)
+		credentialsPath = filepath.Join(clustersDir, clusterName)
 	}
 
 	credentialsPath = filepath.Clean(credentialsPath)
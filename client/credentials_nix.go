@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 // CredentialsNextStepsString returns instructions to load the cluster credentials
@@ -32,13 +33,32 @@ func getCredentialScriptPath(basepath string, shell string) (string, error) {
 	}
 }
 
-func sourceHelpString(credentialFile string, clusterName string, shell string) string {
-	s := fmt.Sprintf("source %s\n", credentialFile)
+// sourceHelpString returns the command to load the credentials, with the help text in comments.
+// The variables are set on the same line, so that they are not commented out by eval $(carina env).
+func sourceHelpString(credentialFile string, clusterName string, shell string, variables []ShellVariable) string {
+	s := fmt.Sprintf("source %s", credentialFile)
+	for _, variable := range variables {
+		s += "; " + shellExportCommand(shell, variable)
+	}
+	s += "\n"
 	s += fmt.Sprintf("# Run the command below to load environment variables for docker or kubectl:\n")
 	s += fmt.Sprintf("# eval $(carina env %s)", clusterName)
 	return s
 }
 
+func shellExportCommand(shell string, variable ShellVariable) string {
+	switch shell {
+	case "fish":
+		if variable.Value == "" {
+			return "set -e " + variable.Name
+		}
+		value := strings.Replace(strings.Replace(variable.Value, `\`, `\\`, -1), "'", `\'`, -1)
+		return fmt.Sprintf("set -gx %s '%s'", variable.Name, value)
+	default:
+		return posixExportCommand(variable)
+	}
+}
+
 func userHomeDir() (string, error) {
 	home := os.Getenv("HOME")
 	if home != "" {
@@ -0,0 +1,21 @@
+package client
+
+import "testing"
+
+func TestPosixExportCommand(t *testing.T) {
+	testcases := []struct {
+		variable ShellVariable
+		expected string
+	}{
+		{ShellVariable{Name: "CARINA_CLUSTER", Value: "mycluster"}, "export CARINA_CLUSTER='mycluster'"},
+		{ShellVariable{Name: "CARINA_CLUSTER", Value: "it's mine"}, `export CARINA_CLUSTER='it'\''s mine'`},
+		{ShellVariable{Name: "CARINA_PROFILE", Value: ""}, "unset CARINA_PROFILE"},
+	}
+
+	for _, tc := range testcases {
+		actual := posixExportCommand(tc.variable)
+		if actual != tc.expected {
+			t.Errorf("Expected %s, got %s", tc.expected, actual)
+		}
+	}
+}
@@ -43,25 +43,53 @@ func forceUnixPath(winPath string) string {
 	return unixPath
 }
 
-func sourceHelpString(credentialFile string, clusterName string, shell string) string {
+// sourceHelpString returns the command to load the credentials for the shell, with the help text in comments.
+// The variables are set by the same command line as the credentials are loaded.
+func sourceHelpString(credentialFile string, clusterName string, shell string, variables []ShellVariable) string {
+	var exports string
+	for _, variable := range variables {
+		exports += shellExportSeparator(shell) + shellExportCommand(shell, variable)
+	}
+
 	switch shell {
 	case "powershell":
-		s := fmt.Sprintf(". %s\n", credentialFile)
+		s := fmt.Sprintf(". %s%s\n", credentialFile, exports)
 		s += fmt.Sprintf("# Run the command below to load environment variables for docker or kubectl:\n")
 		s += fmt.Sprintf("# carina env %s --shell powershell | iex", clusterName) // PowerShell bombs if you have an empty line, leaving out
 		return s
 	case "cmd":
 		s := fmt.Sprintf("# Run the command below to load environment variables for docker or kubectl:\n")
-		s += fmt.Sprintf("CALL %s\n", credentialFile)
+		s += fmt.Sprintf("CALL %s%s\n", credentialFile, exports)
 		return s
 	default: // Windows Bash
-		s := fmt.Sprintf("source %s\n", forceUnixPath(credentialFile))
+		s := fmt.Sprintf("source %s%s\n", forceUnixPath(credentialFile), exports)
 		s += fmt.Sprintf("# Run the command below to load environment variables for docker or kubectl:\n")
 		s += fmt.Sprintf("# eval $(carina env %s)\n", clusterName)
 		return s
 	}
 }
 
+func shellExportSeparator(shell string) string {
+	if shell == "cmd" {
+		return " & "
+	}
+	return "; "
+}
+
+func shellExportCommand(shell string, variable ShellVariable) string {
+	switch shell {
+	case "powershell":
+		if variable.Value == "" {
+			return fmt.Sprintf("Remove-Item Env:%s -ErrorAction SilentlyContinue", variable.Name)
+		}
+		return fmt.Sprintf("$env:%s='%s'", variable.Name, strings.Replace(variable.Value, "'", "''", -1))
+	case "cmd":
+		return fmt.Sprintf(`SET "%s=%s"`, variable.Name, variable.Value)
+	default:
+		return posixExportCommand(variable)
+	}
+}
+
 func userHomeDir() (string, error) {
 	home := os.Getenv("HOME")
 	if home != "" {
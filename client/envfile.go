@@ -0,0 +1,134 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// EnvFile is the set of environment variables exported by a shell script, such as an OpenStack openrc file
+type EnvFile struct {
+	// Values are the exported variables with a literal value
+	Values map[string]string
+
+	// Prompted are the exported variables whose value is read from the user when the script runs
+	Prompted map[string]bool
+
+	// References are the exported variables set to another environment variable, which is not defined by the script
+	References map[string]string
+}
+
+var exportPattern = regexp.MustCompile(`^\s*export\s+([A-Za-z_][A-Za-z0-9_]*)=(.*)$`)
+var readPattern = regexp.MustCompile(`^\s*read\s+(?:-[A-Za-z]+\s+)*([A-Za-z_][A-Za-z0-9_]*)\s*$`)
+var variablePattern = regexp.MustCompile(`^\$(?:\{([A-Za-z_][A-Za-z0-9_]*)\}|([A-Za-z_][A-Za-z0-9_]*))$`)
+
+// ParseEnvFile reads the export statements of a shell script, without running it
+func ParseEnvFile(contents []byte) (*EnvFile, error) {
+	envFile := &EnvFile{
+		Values:     make(map[string]string),
+		Prompted:   make(map[string]bool),
+		References: make(map[string]string),
+	}
+
+	// Variables assigned by read, e.g. read -sr OS_PASSWORD_INPUT
+	prompts := make(map[string]bool)
+
+	scanner := bufio.NewScanner(bytes.NewReader(contents))
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := scanner.Text()
+
+		if match := readPattern.FindStringSubmatch(line); match != nil {
+			prompts[match[1]] = true
+			continue
+		}
+
+		match := exportPattern.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		name := match[1]
+
+		value, err := unquoteShellValue(match[2])
+		if err != nil {
+			return nil, errors.Wrapf(err, "Unable to read %s on line %d", name, lineNumber)
+		}
+
+		delete(envFile.Values, name)
+		delete(envFile.Prompted, name)
+		delete(envFile.References, name)
+
+		if ref := variablePattern.FindStringSubmatch(value); ref != nil {
+			refName := ref[1] + ref[2]
+			switch {
+			case prompts[refName]:
+				envFile.Prompted[name] = true
+			case envFile.Values[refName] != "":
+				envFile.Values[name] = envFile.Values[refName]
+			default:
+				envFile.References[name] = refName
+			}
+			continue
+		}
+
+		if value != "" {
+			envFile.Values[name] = value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return envFile, nil
+}
+
+// shellUnescaper removes the escapes which are allowed inside a double quoted shell string
+var shellUnescaper = strings.NewReplacer(`\"`, `"`, `\\`, `\`, `\$`, `$`, "\\`", "`")
+
+// unquoteShellValue reads the value of an assignment, e.g. "abc", 'abc' or abc # comment
+func unquoteShellValue(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	value = strings.TrimSuffix(value, ";")
+
+	switch {
+	case strings.HasPrefix(value, `"`):
+		end := strings.LastIndex(value, `"`)
+		if end == 0 {
+			return "", errors.New("Unterminated double quoted value")
+		}
+		return shellUnescaper.Replace(value[1:end]), nil
+	case strings.HasPrefix(value, "'"):
+		end := strings.LastIndex(value, "'")
+		if end == 0 {
+			return "", errors.New("Unterminated single quoted value")
+		}
+		return value[1:end], nil
+	default:
+		if i := strings.Index(value, " #"); i >= 0 {
+			value = value[:i]
+		}
+		return strings.TrimSpace(value), nil
+	}
+}
+
+// Get returns the first literal value found for the variables
+func (envFile *EnvFile) Get(names ...string) string {
+	for _, name := range names {
+		if value := envFile.Values[name]; value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// Has checks if any of the variables are exported, with a value, a prompt or a reference
+func (envFile *EnvFile) Has(names ...string) bool {
+	for _, name := range names {
+		if envFile.Values[name] != "" || envFile.Prompted[name] || envFile.References[name] != "" {
+			return true
+		}
+	}
+	return false
+}
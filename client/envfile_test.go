@@ -0,0 +1,92 @@
+package client
+
+import (
+	"testing"
+)
+
+const testOpenRCv3 = `#!/usr/bin/env bash
+export OS_AUTH_URL=https://identity.example.com:5000/v3
+export OS_PROJECT_ID=8ca7c5e6bf9b4b0c9dd1d2b5e4c1a2f3
+export OS_PROJECT_NAME="admin"
+export OS_USER_DOMAIN_NAME="Default"
+if [ -z "$OS_USER_DOMAIN_NAME" ]; then unset OS_USER_DOMAIN_NAME; fi
+unset OS_TENANT_ID
+unset OS_TENANT_NAME
+export OS_USERNAME="alicia"
+echo "Please enter your OpenStack Password for project $OS_PROJECT_NAME as user $OS_USERNAME: "
+read -sr OS_PASSWORD_INPUT
+export OS_PASSWORD=$OS_PASSWORD_INPUT
+export OS_REGION_NAME="RegionOne"
+if [ -z "$OS_REGION_NAME" ]; then unset OS_REGION_NAME; fi
+export OS_INTERFACE=public
+export OS_IDENTITY_API_VERSION=3
+`
+
+const testOpenRCv2 = `export OS_AUTH_URL=https://identity.example.com:5000/v2.0
+export OS_TENANT_NAME='demo'
+export OS_USERNAME=bob # the demo user
+export OS_PASSWORD="p@ss\"word\$"
+export OS_REGION_NAME=""
+`
+
+const testRackspaceEnv = `export RS_USERNAME=alicia
+export RS_API_KEY=${RACKSPACE_KEY}
+export CARINA_REGION=iad;
+`
+
+func TestParseOpenRCv3(t *testing.T) {
+	envFile, err := ParseEnvFile([]byte(testOpenRCv3))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if envFile.Get("OS_AUTH_URL") != "https://identity.example.com:5000/v3" {
+		t.Errorf("Expected the auth url, got %s", envFile.Get("OS_AUTH_URL"))
+	}
+	if envFile.Get("OS_PROJECT_NAME") != "admin" || envFile.Get("OS_USERNAME") != "alicia" {
+		t.Errorf("Expected the double quotes to be removed, got %v", envFile.Values)
+	}
+	if !envFile.Prompted["OS_PASSWORD"] || envFile.Values["OS_PASSWORD"] != "" {
+		t.Errorf("Expected the password to be prompted, got %v", envFile.Values)
+	}
+	if envFile.Get("OS_INTERFACE") != "public" {
+		t.Errorf("Expected an unquoted value, got %s", envFile.Get("OS_INTERFACE"))
+	}
+	if envFile.Has("OS_TENANT_NAME") {
+		t.Error("Expected only exported variables to be found")
+	}
+}
+
+func TestParseOpenRCv2(t *testing.T) {
+	envFile, err := ParseEnvFile([]byte(testOpenRCv2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if envFile.Get("OS_PROJECT_NAME", "OS_TENANT_NAME") != "demo" {
+		t.Errorf("Expected the tenant name, got %v", envFile.Values)
+	}
+	if envFile.Get("OS_USERNAME") != "bob" {
+		t.Errorf("Expected the trailing comment to be removed, got %s", envFile.Get("OS_USERNAME"))
+	}
+	if envFile.Get("OS_PASSWORD") != `p@ss"word$` {
+		t.Errorf("Expected the escapes to be removed, got %s", envFile.Get("OS_PASSWORD"))
+	}
+	if envFile.Has("OS_REGION_NAME") {
+		t.Error("Expected an empty value to be skipped")
+	}
+}
+
+func TestParseRackspaceEnvFile(t *testing.T) {
+	envFile, err := ParseEnvFile([]byte(testRackspaceEnv))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if envFile.References["RS_API_KEY"] != "RACKSPACE_KEY" {
+		t.Errorf("Expected the apikey to reference RACKSPACE_KEY, got %v", envFile.References)
+	}
+	if envFile.Get("CARINA_REGION", "RS_REGION_NAME") != "iad" {
+		t.Errorf("Expected the trailing semicolon to be removed, got %v", envFile.Values)
+	}
+}
@@ -16,7 +16,7 @@ type UserError struct {
 func newClientError(err error) *UserError {
 	return &UserError{
 		error:   err,
-		Context: common.Log.ErrorContext,
+		Context: common.Log.GetErrorContext(),
 	}
 }
 
@@ -0,0 +1,21 @@
+// +build !windows
+
+package client
+
+import (
+	"os"
+	"syscall"
+)
+
+// tryLockFile attempts to take an exclusive lock on the file without blocking
+func tryLockFile(f *os.File) (bool, error) {
+	err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err == syscall.EWOULDBLOCK {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func unlockFile(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+}
@@ -0,0 +1,87 @@
+package client
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// fileLockTimeout is how long to wait for another carina process to release a lock
+const fileLockTimeout = 10 * time.Second
+
+// fileLockRetryInterval is how often to retry acquiring a lock held by another process
+const fileLockRetryInterval = 50 * time.Millisecond
+
+// fileLock is an exclusive advisory lock, shared between carina processes, on a file.
+// The lock is held on a separate .lock file so that the locked file can be atomically replaced.
+type fileLock struct {
+	file *os.File
+}
+
+// acquireFileLock locks the file at path, waiting for other processes to release it first
+func acquireFileLock(path string) (*fileLock, error) {
+	lockPath := path + ".lock"
+	f, err := os.OpenFile(lockPath, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to open the lock file %s", lockPath)
+	}
+
+	deadline := time.Now().Add(fileLockTimeout)
+	for {
+		ok, err := tryLockFile(f)
+		if err != nil {
+			f.Close()
+			return nil, errors.Wrapf(err, "Unable to lock %s", lockPath)
+		}
+		if ok {
+			return &fileLock{file: f}, nil
+		}
+
+		if time.Now().After(deadline) {
+			f.Close()
+			return nil, errors.Errorf("Timed out waiting for another carina process to release %s", lockPath)
+		}
+		time.Sleep(fileLockRetryInterval)
+	}
+}
+
+// release unlocks the file. The .lock file is left behind, deleting it would race with other processes.
+func (lock *fileLock) release() error {
+	defer lock.file.Close()
+	return unlockFile(lock.file)
+}
+
+// WriteFileAtomic replaces the file at path with contents, so that readers never see a partially written file.
+// The contents are written to a temporary file in the same directory, which is then renamed over the original.
+func WriteFileAtomic(path string, contents []byte, perm os.FileMode) error {
+	dir, filename := filepath.Split(path)
+	tmp, err := ioutil.TempFile(dir, filename+".tmp")
+	if err != nil {
+		return errors.Wrap(err, "Unable to create a temporary file")
+	}
+
+	// Clean up the temporary file unless it was successfully renamed
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+
+	_, err = tmp.Write(contents)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return errors.Wrapf(err, "Unable to write %s", tmpPath)
+	}
+
+	err = os.Chmod(tmpPath, perm)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to set permissions on %s", tmpPath)
+	}
+
+	return errors.Wrapf(os.Rename(tmpPath, path), "Unable to replace %s", path)
+}
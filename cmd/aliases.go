@@ -0,0 +1,203 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/getcarina/carina/client"
+	"github.com/getcarina/carina/common"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// aliasesSection is the config section which holds user-defined command aliases
+const aliasesSection = "aliases"
+
+// aliasEnvVar is set to the name of the alias when carina runs its expanded command, so that aliases are not registered again.
+// This keeps an alias from expanding to another alias, and possibly itself.
+const aliasEnvVar = "CARINA_EXPANDED_ALIAS"
+
+// loadAliases reads the [aliases] section of the config file. It runs before the command line is parsed,
+// so --config is found by scanning the arguments. Errors reading the config file are reported later by initConfig.
+func loadAliases(args []string) map[string]string {
+	configFile := findConfigFlag(args)
+	if configFile == "" {
+		var err error
+		configFile, err = client.FindConfigFile()
+		if err != nil || configFile == "" {
+			return nil
+		}
+	}
+
+	config := viper.New()
+	config.SetConfigFile(configFile)
+	if err := config.ReadInConfig(); err != nil {
+		return nil
+	}
+	return config.GetStringMapString(aliasesSection)
+}
+
+// findConfigFlag returns the value of --config from unparsed arguments
+func findConfigFlag(args []string) string {
+	for i, arg := range args {
+		switch {
+		case arg == "--":
+			return ""
+		case strings.HasPrefix(arg, "--config="):
+			return strings.TrimPrefix(arg, "--config=")
+		case arg == "--config" && i+1 < len(args):
+			return args[i+1]
+		}
+	}
+	return ""
+}
+
+// addAliasCommands adds a command for each alias, so that aliases are listed in --help and shell completion.
+// Aliases which would replace a carina command, or cannot be parsed, are skipped and returned with the reason.
+func addAliasCommands(root *cobra.Command, aliases map[string]string) (registered map[string]string, invalid map[string]string) {
+	registered = make(map[string]string)
+	invalid = make(map[string]string)
+
+	var names []string
+	for name := range aliases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		expansion := aliases[name]
+		if isBuiltinCommand(root, name) {
+			invalid[name] = fmt.Sprintf("it would replace the carina %s command", name)
+			continue
+		}
+		if name == "" || strings.HasPrefix(name, "-") || strings.IndexFunc(name, unicode.IsSpace) != -1 {
+			invalid[name] = "it is not a valid command name"
+			continue
+		}
+
+		args, err := splitAliasArgs(expansion)
+		if err != nil {
+			invalid[name] = err.Error()
+			continue
+		}
+		if len(args) == 0 {
+			invalid[name] = "it is empty"
+			continue
+		}
+
+		root.AddCommand(newAliasCommand(root, name, expansion, args))
+		registered[name] = expansion
+	}
+
+	return registered, invalid
+}
+
+func isBuiltinCommand(root *cobra.Command, name string) bool {
+	// The help command is only added when the root command is executed
+	if name == "help" {
+		return true
+	}
+
+	for _, cmd := range root.Commands() {
+		if cmd.Name() == name || cmd.HasAlias(name) {
+			return true
+		}
+	}
+	return false
+}
+
+func newAliasCommand(root *cobra.Command, name string, expansion string, args []string) *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   name,
+		Short: fmt.Sprintf("Alias for %s", expansion),
+		Long:  fmt.Sprintf("Alias for carina %s, defined in the [aliases] section of the config file. Additional arguments are appended.", expansion),
+		// The arguments are passed through to the expanded command, which parses them
+		DisableFlagParsing: true,
+		// The expanded command prints its own errors
+		SilenceErrors: true,
+		SilenceUsage:  true,
+		RunE: func(cmd *cobra.Command, extraArgs []string) error {
+			return runAlias(name, append(append([]string{}, args...), extraArgs...))
+		},
+	}
+
+	// Complete the alias the same as the command it expands to
+	target, _, err := root.Find(args)
+	if err == nil && target != root {
+		cmd.ValidArgs = target.ValidArgs
+		cmd.Flags().AddFlagSet(target.NonInheritedFlags())
+	}
+
+	return cmd
+}
+
+// runAlias runs the expanded alias in a new carina process, the same as when the command is run directly, without aliases
+func runAlias(name string, args []string) error {
+	rerun := exec.Command(os.Args[0], args...)
+	rerun.Env = append(os.Environ(), aliasEnvVar+"="+name)
+	rerun.Stdin = os.Stdin
+	rerun.Stdout = os.Stdout
+	rerun.Stderr = os.Stderr
+	err := rerun.Run()
+	if _, exited := err.(*exec.ExitError); err != nil && !exited {
+		// The expanded command prints its own errors, only report when it couldn't be run
+		common.Log.WriteError("Unable to run the %s alias", err, name)
+	}
+	return err
+}
+
+// isExpandingAlias checks if carina is running the expanded command of an alias
+func isExpandingAlias() bool {
+	return os.Getenv(aliasEnvVar) != ""
+}
+
+// isAliasCommand checks if a command was added for an alias
+func isAliasCommand(cmd *cobra.Command) bool {
+	_, isAlias := cxt.Aliases[cmd.Name()]
+	return isAlias && cmd.Parent() == cmd.Root()
+}
+
+// splitAliasArgs splits an alias into arguments on whitespace, keeping quoted arguments together,
+// e.g. create --template "Kubernetes 1.4*" becomes create, --template and Kubernetes 1.4*
+func splitAliasArgs(alias string) ([]string, error) {
+	var args []string
+	var current bytes.Buffer
+	var quote rune
+	inArg := false
+
+	for _, r := range alias {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote = r
+			inArg = true
+		case unicode.IsSpace(r):
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, fmt.Errorf("it has an unterminated %c quote", quote)
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
@@ -10,11 +10,11 @@ func newBashCompletionCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:               "bash-completion",
 		Short:             "Generate a bash completion file for the carina cli",
-		Long:              "Generate a bash completion file for the carina cli",
+		Long:              "Generate a bash completion file for the carina cli. Use carina completion bash instead.",
 		Hidden:            true,
 		PersistentPreRunE: unauthenticatedPreRunE,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return cmd.Parent().GenBashCompletion(os.Stdout)
+			return writeBashCompletion(cmd.Root(), os.Stdout)
 		},
 	}
 
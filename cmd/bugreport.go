@@ -0,0 +1,305 @@
+package cmd
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/getcarina/carina/client"
+	"github.com/getcarina/carina/common"
+	"github.com/getcarina/carina/console"
+	"github.com/getcarina/carina/version"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// requestIDPattern finds the request ids in the debug log
+var requestIDPattern = regexp.MustCompile(`Request ID: ([^"\s]+)`)
+
+// bugReportSecretFlags are the flags whose values are masked in the bug report
+var bugReportSecretFlags = []string{"apikey", "api-key", "password", "passphrase"}
+
+// bugReportEnvPrefixes are the prefixes of the environment variables which affect carina
+var bugReportEnvPrefixes = []string{"CARINA_", "RS_", "OS_"}
+
+func newBugReportCommand() *cobra.Command {
+	var options struct {
+		output string
+	}
+
+	var cmd = &cobra.Command{
+		Use:   "bugreport [-- <command>]",
+		Short: "Collect diagnostic information for a bug report",
+		Long: `Collect diagnostic information for a bug report into a single zip archive.
+
+The archive contains the version and build information, the carina environment variables and profile names, and the cache metadata. When a command is specified, it is run again with --debug, and its debug log, request ids and HTTP requests are included as well.
+
+Secrets, such as passwords, API keys, tokens and private keys, are masked. Review the archive before attaching it to a bug report.`,
+		Example: `  carina bugreport
+  carina bugreport -- ls
+  carina bugreport --output report.zip -- --profile dev credentials mycluster`,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			// Skip authentication, a bug report must work when authentication is broken
+			cxt.initializeLogging()
+			cxt.Client = client.NewClient(cxt.CacheEnabled)
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			for _, arg := range args {
+				if arg == "bugreport" {
+					return errors.New("carina bugreport cannot report on itself")
+				}
+				// The command's HTTP requests are recorded into the bug report, another cassette would leave it empty
+				if arg == "--record" || strings.HasPrefix(arg, "--record=") {
+					return errors.New("carina bugreport records the command's HTTP requests itself, remove --record from the command")
+				}
+			}
+
+			output := options.output
+			if output == "" {
+				output = fmt.Sprintf("carina-bugreport-%s.zip", time.Now().Format("20060102-150405"))
+			}
+
+			files := []bugReportFile{
+				{"version.txt", describeBuild()},
+				{"settings.log", describeSettings()},
+				{"cache.txt", describeCache(cxt.Client.Cache)},
+			}
+
+			if len(args) > 0 {
+				runFiles, err := rerunWithDebug(args)
+				if err != nil {
+					return err
+				}
+				files = append(files, runFiles...)
+			}
+
+			err := writeBugReport(output, files)
+			if err != nil {
+				return err
+			}
+
+			console.Write("Wrote the bug report to %s", output)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&options.output, "output", "", "The archive to write. Defaults to carina-bugreport-[timestamp].zip in the current directory")
+	cmd.SetUsageTemplate(cmd.UsageTemplate())
+
+	return cmd
+}
+
+// bugReportFile is a file in the bug report archive
+type bugReportFile struct {
+	name     string
+	contents []byte
+}
+
+func describeBuild() []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "Version: %s\n", version.Version)
+	fmt.Fprintf(&buf, "Commit: %s\n", version.Commit)
+	fmt.Fprintf(&buf, "Go: %s\n", runtime.Version())
+	fmt.Fprintf(&buf, "OS: %s/%s\n", runtime.GOOS, runtime.GOARCH)
+	return buf.Bytes()
+}
+
+// describeSettings logs the environment variables with WriteSetting, so that secrets are masked, and the profiles in the config file
+func describeSettings() []byte {
+	var env []string
+	for _, value := range os.Environ() {
+		for _, prefix := range bugReportEnvPrefixes {
+			if strings.HasPrefix(value, prefix) {
+				env = append(env, value)
+				break
+			}
+		}
+	}
+	sort.Strings(env)
+
+	return captureDebugLog(func() {
+		for _, value := range env {
+			parts := strings.SplitN(value, "=", 2)
+			common.Log.WriteSetting(parts[0], "environment", parts[1])
+		}
+
+		configFile := viper.ConfigFileUsed()
+		if configFile == "" {
+			common.Log.WriteDebug("Config: none found")
+			return
+		}
+		common.Log.WriteDebug("Config: %s", configFile)
+		common.Log.WriteDebug("Profiles: %s", strings.Join(listProfiles(), ", "))
+	})
+}
+
+// describeCache summarizes the cache, the same as carina cache show
+func describeCache(cache *client.Cache) []byte {
+	var buf bytes.Buffer
+	if cache.Path() == "" {
+		fmt.Fprintln(&buf, "The cache is disabled")
+		return buf.Bytes()
+	}
+
+	fmt.Fprintf(&buf, "Path: %s\n", cache.Path())
+	fmt.Fprintf(&buf, "Schema Version: %d\n", cache.Version)
+	fmt.Fprintf(&buf, "Last Update Check: %s\n", cache.LastUpdateCheck.Format(time.RFC1123))
+	if cache.LoadedCluster != nil {
+		fmt.Fprintf(&buf, "Loaded Cluster: %s\n", cache.LoadedCluster.Cluster)
+	}
+
+	var ids []string
+	for id := range cache.Accounts {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		item := cache.Accounts[id]
+		fmt.Fprintf(&buf, "\nAccount: %s\n", id)
+		fmt.Fprintf(&buf, "  Endpoint: %s\n", valueOrDash(item["endpoint"]))
+		fmt.Fprintf(&buf, "  Token: %s\n", maskSecret(item["token"]))
+		fmt.Fprintf(&buf, "  Token Expires: %s\n", describeTokenExpiry(item["token"], item["token-expires"]))
+		fmt.Fprintf(&buf, "  Active Cluster: %s\n", valueOrDash(cache.ActiveClusters[id].Name))
+	}
+
+	return buf.Bytes()
+}
+
+// rerunWithDebug runs a carina command again in a new process, the same as when the command is run directly,
+// with its debug log captured and its HTTP requests recorded
+func rerunWithDebug(args []string) ([]bugReportFile, error) {
+	cassette, err := ioutil.TempFile("", "carina-bugreport")
+	if err != nil {
+		return nil, err
+	}
+	cassette.Close()
+	defer os.Remove(cassette.Name())
+
+	runArgs := append([]string{"--debug"}, args...)
+	replaying := false
+	for _, arg := range args {
+		if arg == "--replay" || strings.HasPrefix(arg, "--replay=") {
+			replaying = true
+		}
+	}
+	if !replaying {
+		runArgs = append([]string{"--record", cassette.Name()}, runArgs...)
+	}
+
+	var debugLog bytes.Buffer
+	rerun := exec.Command(os.Args[0], runArgs...)
+	rerun.Stdin = os.Stdin
+	rerun.Stdout = &debugLog
+	rerun.Stderr = &debugLog
+	runErr := rerun.Run()
+	if _, exited := runErr.(*exec.ExitError); runErr != nil && !exited {
+		return nil, fmt.Errorf("Unable to run carina %s: %s", strings.Join(args, " "), runErr)
+	}
+
+	var summary bytes.Buffer
+	fmt.Fprintf(&summary, "Command: carina %s\n", strings.Join(maskSecretArgs(args), " "))
+	if runErr != nil {
+		fmt.Fprintf(&summary, "Result: %s\n", runErr)
+	} else {
+		fmt.Fprintln(&summary, "Result: success")
+	}
+
+	// The request ids are logged by the command, in the order the requests were made
+	var requestIDs bytes.Buffer
+	seen := make(map[string]bool)
+	for _, match := range requestIDPattern.FindAllSubmatch(debugLog.Bytes(), -1) {
+		requestID := string(match[1])
+		if !seen[requestID] {
+			seen[requestID] = true
+			fmt.Fprintf(&requestIDs, "Request ID: %s\n", requestID)
+		}
+	}
+
+	files := []bugReportFile{
+		{"command.txt", summary.Bytes()},
+		{"debug.log", debugLog.Bytes()},
+		{"request-ids.txt", requestIDs.Bytes()},
+	}
+
+	// A replayed command already has its HTTP requests in the cassette
+	if !replaying {
+		httpTrace, err := ioutil.ReadFile(cassette.Name())
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, bugReportFile{"http.json", httpTrace})
+	}
+
+	return files, nil
+}
+
+// maskSecretArgs returns a copy of the arguments with the values of flags which hold secrets masked, e.g. --apikey
+func maskSecretArgs(args []string) []string {
+	masked := make([]string, len(args))
+	copy(masked, args)
+	for i, arg := range masked {
+		for _, flag := range bugReportSecretFlags {
+			switch {
+			case arg == "--"+flag && i+1 < len(masked):
+				masked[i+1] = maskSecret(masked[i+1])
+			case strings.HasPrefix(arg, "--"+flag+"="):
+				masked[i] = "--" + flag + "=" + maskSecret(strings.TrimPrefix(arg, "--"+flag+"="))
+			}
+		}
+	}
+	return masked
+}
+
+// captureDebugLog returns the debug log written by an action, instead of printing it
+func captureDebugLog(action func()) []byte {
+	var buf bytes.Buffer
+	out, level, formatter := common.Log.Out, common.Log.Level, common.Log.Formatter
+	common.Log.Out = &buf
+	common.Log.Formatter = plainFormatter{}
+	common.Log.SetDebug()
+	defer func() {
+		common.Log.Out, common.Log.Level, common.Log.Formatter = out, level, formatter
+	}()
+
+	action()
+	return buf.Bytes()
+}
+
+// plainFormatter formats log entries as plain text, e.g. debug: UserName: --username
+type plainFormatter struct{}
+
+func (plainFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	return []byte(fmt.Sprintf("%s: %s\n", entry.Level, entry.Message)), nil
+}
+
+func writeBugReport(path string, files []bugReportFile) error {
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for _, file := range files {
+		writer, err := archive.Create(file.name)
+		if err != nil {
+			return err
+		}
+		_, err = writer.Write(file.contents)
+		if err != nil {
+			return err
+		}
+	}
+	err := archive.Close()
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, buf.Bytes(), 0600)
+}
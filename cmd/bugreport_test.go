@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMaskSecretArgs(t *testing.T) {
+	testcases := []struct {
+		args     []string
+		expected []string
+	}{
+		{
+			args:     []string{"--apikey", "x", "ls"},
+			expected: []string{"--apikey", "****", "ls"},
+		},
+		{
+			args:     []string{"--password=abcdefghijkl", "ls"},
+			expected: []string{"--password=****ijkl", "ls"},
+		},
+		{
+			args:     []string{"--profile", "dev", "credentials", "mycluster"},
+			expected: []string{"--profile", "dev", "credentials", "mycluster"},
+		},
+		{
+			args:     []string{"ls", "--apikey"},
+			expected: []string{"ls", "--apikey"},
+		},
+	}
+
+	for _, tc := range testcases {
+		original := append([]string(nil), tc.args...)
+		assert.Equal(t, tc.expected, maskSecretArgs(tc.args))
+		assert.Equal(t, original, tc.args, "Expected the arguments to be left unchanged")
+	}
+}
+
+func TestBugReportRejectsRecord(t *testing.T) {
+	for _, args := range [][]string{{"--record", "http.json", "ls"}, {"--record=http.json", "ls"}} {
+		cmd := newBugReportCommand()
+		err := cmd.RunE(cmd, args)
+		if assert.Error(t, err, "Expected %v to be rejected", args) {
+			assert.Contains(t, err.Error(), "--record")
+		}
+	}
+}
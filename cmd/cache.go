@@ -0,0 +1,32 @@
+package cmd
+
+import (
+	"github.com/getcarina/carina/client"
+	"github.com/spf13/cobra"
+)
+
+func newCacheCommand() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "cache",
+		Short: "Inspect and clear the cache",
+		Long: `Inspect and clear the cache of authentication tokens, selected clusters and release checks.
+
+Clearing the cache forces carina to authenticate again, which is the first thing to try when authentication breaks.`,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			// Skip authentication and the release check, these must work when authentication is broken
+			cxt.initializeLogging()
+			cxt.Client = client.NewClient(cxt.CacheEnabled)
+			return nil
+		},
+	}
+
+	cmd.AddCommand(
+		newCacheClearCommand(),
+		newCachePathCommand(),
+		newCacheShowCommand(),
+	)
+
+	cmd.SetUsageTemplate(cmd.UsageTemplate())
+
+	return cmd
+}
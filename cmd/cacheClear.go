@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/getcarina/carina/console"
+	"github.com/spf13/cobra"
+)
+
+func newCacheClearCommand() *cobra.Command {
+	var options struct {
+		account string
+	}
+
+	var cmd = &cobra.Command{
+		Use:   "clear",
+		Short: "Clear the cache",
+		Long: `Clear the entire cache, or only the cached values for a single account.
+
+Use --profile to clear the account used by a profile, or --account with an account from carina cache show.`,
+		Example: `  carina cache clear
+  carina cache clear --profile dev
+  carina cache clear --account public-dfw-alicia`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if options.account != "" && cxt.Profile != "" {
+				return fmt.Errorf("Use either --account or --profile, not both")
+			}
+
+			id := options.account
+			if cxt.Profile != "" {
+				accounts, err := cxt.buildProfileAccounts([]string{cxt.Profile}, nil)
+				if err != nil {
+					return err
+				}
+				id = accounts[0].Account.GetID()
+			}
+
+			if id == "" {
+				err := cxt.Client.Cache.Clear()
+				if err != nil {
+					return err
+				}
+				console.Write("Cleared the cache")
+				return nil
+			}
+
+			found, err := cxt.Client.Cache.ClearAccount(id)
+			if err != nil {
+				return err
+			}
+			if !found {
+				return fmt.Errorf("Nothing is cached for account %s", id)
+			}
+
+			console.Write("Cleared the cache for account %s", id)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&options.account, "account", "", "Only clear the cached values for this account, as listed by carina cache show")
+	cmd.SetUsageTemplate(cmd.UsageTemplate())
+
+	return cmd
+}
@@ -0,0 +1,30 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/getcarina/carina/client"
+	"github.com/spf13/cobra"
+)
+
+func newCachePathCommand() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "path",
+		Short: "Show the location of the cache",
+		Long:  "Show the location of the cache file",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// Always print the location, even when the cache is disabled because it couldn't be read
+			path, err := client.GetCacheFilename()
+			if err != nil {
+				return err
+			}
+
+			fmt.Println(path)
+			return nil
+		},
+	}
+
+	cmd.SetUsageTemplate(cmd.UsageTemplate())
+
+	return cmd
+}
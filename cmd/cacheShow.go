@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/getcarina/carina/common"
+	"github.com/getcarina/carina/console"
+	"github.com/spf13/cobra"
+)
+
+func newCacheShowCommand() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "show",
+		Short: "Show the contents of the cache",
+		Long:  "Show the contents of the cache. Tokens are masked.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cache := cxt.Client.Cache
+			if cache.Path() == "" {
+				return errors.New("The cache is disabled")
+			}
+
+			lastCheck := "never"
+			if !cache.LastUpdateCheck.IsZero() {
+				lastCheck = cache.LastUpdateCheck.Local().Format(time.RFC1123)
+			}
+			items := []console.Tuple{
+				{Key: "Path", Value: cache.Path()},
+				{Key: "Schema Version", Value: cache.Version},
+				{Key: "Last Update Check", Value: lastCheck},
+			}
+			if cache.LoadedCluster != nil {
+				items = append(items, console.Tuple{Key: "Loaded Cluster", Value: cache.LoadedCluster.Cluster})
+			}
+			console.WriteMap(items)
+
+			var ids []string
+			for id := range cache.Accounts {
+				ids = append(ids, id)
+			}
+			for id := range cache.ActiveClusters {
+				if _, ok := cache.Accounts[id]; !ok {
+					ids = append(ids, id)
+				}
+			}
+			if len(ids) == 0 {
+				return nil
+			}
+			sort.Strings(ids)
+
+			fmt.Println()
+			data := [][]string{{"Account", "Endpoint", "Token", "Token Expires", "Active Cluster"}}
+			for _, id := range ids {
+				item := cache.Accounts[id]
+				data = append(data, []string{
+					id,
+					valueOrDash(item["endpoint"]),
+					maskSecret(item["token"]),
+					describeTokenExpiry(item["token"], item["token-expires"]),
+					valueOrDash(cache.ActiveClusters[id].Name),
+				})
+			}
+			console.WriteTable(data)
+
+			return nil
+		},
+	}
+
+	cmd.SetUsageTemplate(cmd.UsageTemplate())
+
+	return cmd
+}
+
+// maskSecret hides all but the last few characters of a secret, so that it can be recognized without being revealed
+func maskSecret(secret string) string {
+	if secret == "" {
+		return "-"
+	}
+	if common.IsEncryptedString(secret) {
+		return "(encrypted)"
+	}
+	if len(secret) <= 8 {
+		return "****"
+	}
+	return "****" + secret[len(secret)-4:]
+}
+
+func describeTokenExpiry(token string, value string) string {
+	if token == "" {
+		return "-"
+	}
+
+	expires := common.ParseTokenExpiry(value)
+	if expires.IsZero() {
+		return "unknown"
+	}
+
+	remaining := expires.Sub(time.Now())
+	switch {
+	case remaining <= 0:
+		return fmt.Sprintf("expired %s ago", roundToMinute(-remaining))
+	case remaining > 48*time.Hour:
+		return expires.Local().Format("2006-01-02 15:04")
+	default:
+		return fmt.Sprintf("in %s", roundToMinute(remaining))
+	}
+}
+
+// roundToMinute rounds a positive duration to the nearest minute, e.g. 1h30m0s
+func roundToMinute(d time.Duration) time.Duration {
+	return time.Duration((int64(d)+int64(time.Minute)/2)/int64(time.Minute)) * time.Minute
+}
+
+func valueOrDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
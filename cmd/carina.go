@@ -42,10 +42,11 @@ func newCarinaCommand() *cobra.Command {
 	//
 	// Global application flags
 	//
-	cmd.PersistentFlags().StringVar(&cxt.ConfigFile, "config", "", "config file (default is CARINA_HOME/config.toml)")
+	cmd.PersistentFlags().StringVar(&cxt.ConfigFile, "config", "", "config file (default is the first config.toml, config.yaml or config.json found in CARINA_HOME, $XDG_CONFIG_HOME/carina or ~/.carina)")
 	cmd.PersistentFlags().BoolVar(&cxt.CacheEnabled, "cache", true, "Cache API tokens and update times")
 	cmd.PersistentFlags().BoolVar(&cxt.Debug, "debug", false, "Print additional debug messages to stdout")
 	cmd.PersistentFlags().BoolVar(&cxt.Silent, "silent", false, "Do not print to stdout")
+	cmd.PersistentFlags().IntVar(&cxt.Retries, "retries", common.DefaultRetryPolicy.Retries, "Number of times to retry a read-only API request which failed with a transient error")
 
 	// Account flags
 	cmd.PersistentFlags().StringVar(&cxt.Profile, "profile", "", "Use saved credentials from a profile [CARINA_PROFILE]")
@@ -60,6 +61,25 @@ func newCarinaCommand() *cobra.Command {
 	cmd.PersistentFlags().StringVar(&cxt.AuthEndpoint, "auth-endpoint", "", "Private Cloud Authentication endpoint [OS_AUTH_URL]")
 	cmd.PersistentFlags().StringVar(&cxt.EndpointOverride, "endpoint", "", "Custom API endpoint [CARINA_ENDPOINT/OS_ENDPOINT]")
 	cmd.PersistentFlags().StringVar(&cxt.CloudType, "cloud", "", "The cloud type: public or private")
+	cmd.PersistentFlags().StringVar(&cxt.OSCloud, "os-cloud", "", "Private Cloud: Use the credentials of a cloud from clouds.yaml [OS_CLOUD]")
+
+	// HTTP flags
+	cmd.PersistentFlags().StringVar(&cxt.Record, "record", "", "Record the API requests and responses, with secrets redacted, to a cassette file which can be attached to a bug report")
+	cmd.PersistentFlags().StringVar(&cxt.Replay, "replay", "", "Replay the API responses from a cassette file made with --record, without connecting to the API")
+	cmd.PersistentFlags().DurationVar(&cxt.Timeout, "timeout", 0, fmt.Sprintf("Time limit for each API request, e.g. 90s. Defaults to %s, or %s when downloading cluster credentials", common.DefaultTimeouts.API, common.DefaultTimeouts.Credentials))
+	cmd.PersistentFlags().DurationVar(&cxt.ConnectTimeout, "connect-timeout", 0, fmt.Sprintf("Time limit for connecting to the API, e.g. 5s. Defaults to %s", common.DefaultTimeouts.Connect))
+	cmd.PersistentFlags().StringVar(&cxt.HTTP.TLS.CACert, "cacert", "", "Trust the certificate authorities in a PEM encoded bundle when connecting to the API [OS_CACERT]")
+	cmd.PersistentFlags().StringVar(&cxt.HTTP.TLS.ClientCert, "client-cert", "", "PEM encoded client certificate presented to the API [OS_CERT]")
+	cmd.PersistentFlags().StringVar(&cxt.HTTP.TLS.ClientKey, "client-key", "", "PEM encoded private key for --client-cert [OS_KEY]")
+	cmd.PersistentFlags().BoolVar(&cxt.HTTP.TLS.Insecure, "insecure", false, "Skip verifying the API's TLS certificate. Not recommended")
+
+	// Private Cloud credentials flags
+	cmd.PersistentFlags().BoolVar(&cxt.CSR, "csr", false, "Private Cloud: Generate the credentials private key locally and only send a certificate signing request")
+	cmd.PersistentFlags().StringVar(&cxt.CSRKeyType, "csr-key-type", "", "Private Cloud: The type of private key generated with --csr. Allowed values: rsa, ecdsa")
+	cmd.PersistentFlags().StringVar(&cxt.CSRCommonName, "csr-common-name", "", "Private Cloud: The certificate common name (CN) requested with --csr. Defaults to the username")
+
+	// Keep the global flags, so that a flag set to its default value can still take precedence over the profile
+	cxt.flags = cmd.PersistentFlags()
 
 	// Hide local development flags
 	cmd.PersistentFlags().MarkHidden("api-key")
@@ -83,7 +103,11 @@ In the following example, 'private' will be used, even when the Rackspace Public
     carina --cloud private ls
 
 Profiles:
-Credentials can be saved under a profile name in CARINA_HOME/config.toml, and then used with the --profile flag. If --profile is not specified, and the config file contains a profile named 'default', it will be used when no credential flags are provided.
+Credentials can be saved under a profile name in the config file, and then used with the --profile flag. If --profile is not specified, and the config file contains a profile named 'default', it will be used when no credential flags are provided.
+
+The config file is the one specified by --config or CARINA_CONFIG, otherwise the first config.toml, config.yaml, config.yml or config.json found in CARINA_HOME, $XDG_CONFIG_HOME/carina, then ~/.carina. When CARINA_HOME or XDG_CONFIG_HOME is set, a config file found only in ~/.carina is copied there, and the original is kept for shells where neither is set.
+
+Use carina profile import to create a profile from an OpenStack openrc file, or a file which exports RS_* or CARINA_* environment variables.
 
 Below is a sample config file:
 
@@ -100,6 +124,46 @@ Below is a sample config file:
     project-var="OS_PROJECT_NAME"
     domain-var="OS_PROJECT_DOMAIN_NAME"
     region-var="OS_REGION_NAME"
+    csr="true"
+    csr-key-type="ecdsa"
+
+    [prod]
+    cloud="public"
+    username="alicia"
+    apikey-cmd="pass show carina/prod-apikey"
+
+    [ci]
+    cloud="public"
+    username="ci-bot"
+    apikey-file="/run/secrets/carina-apikey"
+
+    [staging]
+    os-cloud="staging"
+
+A setting may be read from an environment variable with <setting>-var, from the output of a command with <setting>-cmd, or from a file with <setting>-file. Commands and files must produce a value within 30 seconds.
+
+A private cloud profile may authenticate with an OpenStack application credential, using application-credential-id and application-credential-secret, or a pre-issued token instead of a username and password. The user-id, project-id, user-domain, user-domain-id, project-domain and project-domain-id settings select the user and project with OpenStack Identity v3. Each has an equivalent OS_* environment variable, e.g. OS_APPLICATION_CREDENTIAL_ID or OS_TOKEN.
+
+Any profile may set cacert, client-cert and client-key to use a custom certificate authority bundle, or present a client certificate, when connecting to the API. Set insecure="true" to skip verifying the API's certificate. The --cacert, --client-cert, --client-key and --insecure flags take precedence over the profile.
+
+Any profile may set timeout, e.g. timeout="90s", to limit how long each API request may take, and connect-timeout to limit connecting to the API. The auth-timeout, api-timeout and credentials-timeout settings override timeout for requests to the identity service, the cluster API and when downloading cluster credentials. The --timeout and --connect-timeout flags take precedence over the profile.
+
+A [defaults] section sets default values for command flags, e.g. wait=true, and [defaults.create] for the flags of a single command, e.g. template and nodes. A profile may do the same with [<profile>.defaults] and [<profile>.defaults.create], which take precedence over [defaults]. Flags specified on the command line always take precedence. Run carina doctor, or the command with --debug, to see where each value came from.
+
+    [defaults.create]
+    template="Kubernetes 1.4*"
+    nodes=3
+    wait=true
+
+    [dev.defaults.env]
+    shell="fish"
+
+An [aliases] section defines new commands, which expand to a carina command with its flags. Additional arguments are appended, so with the alias below, carina k8s mycluster runs carina create --template "Kubernetes 1.4*" --nodes 3 --wait mycluster. An alias cannot replace a carina command, or expand to another alias.
+
+    [aliases]
+    k8s="create --template 'Kubernetes 1.4*' --nodes 3 --wait"
+
+A private cloud profile may use os-cloud to read its settings from the clouds.yaml shared with the openstack cli, merged with secure.yaml. Settings in the profile take precedence. Without a profile, use --os-cloud or OS_CLOUD.
 
 In the following example, the default profile is used because no other credentials were explicitly provided:
     carina ls
@@ -114,11 +178,20 @@ See https://getcarina.com/docs/reference/carina-cli for additional documentation
 	if err != nil {
 		carinaHome = err.Error()
 	}
+	configFile := os.Getenv(client.CarinaConfigEnvVar)
+	if configFile == "" {
+		configFile = "(not set)"
+	}
 	envHelp := fmt.Sprintf(`Environment Variables:
   CARINA_HOME
     directory that stores your cluster tokens and credentials
     current setting: %s
-`, carinaHome)
+  %s
+    config file which holds your profiles
+    current setting: %s
+  %s
+    passphrase which encrypts cached tokens and profile secrets, see 'carina config encrypt'
+`, carinaHome, client.CarinaConfigEnvVar, configFile, client.CarinaSecretsPassphraseEnvVar)
 	cmd.SetUsageTemplate(fmt.Sprintf("%s\n%s\n\n%s", cmd.UsageTemplate(), envHelp, authHelp))
 
 	cobra.OnInitialize(initConfig)
@@ -126,19 +199,35 @@ See https://getcarina.com/docs/reference/carina-cli for additional documentation
 	cmd.AddCommand(
 		newAutoScaleCommand(),
 		newBashCompletionCmd(),
+		newBugReportCommand(),
+		newCacheCommand(),
+		newCompleteCommand(),
+		newCompletionCommand(),
+		newConfigCommand(),
 		newCreateCommand(),
 		newCredentialsCommand(),
+		newCurrentCommand(),
 		newDeleteCommand(),
+		newDoctorCommand(),
 		newEnvCommand(),
 		newGetCommand(),
 		newGrowCommand(),
+		newProfileCommand(),
+		newPromptCommand(),
 		newResizeCommand(),
 		newClustersCommand(),
 		newTemplatesCommand(),
 		newQuotasCommand(),
 		newRebuildCommand(),
+		newUseCommand(),
 		newVersionCommand(),
 	)
+
+	// Aliases are added once the built-in commands are known, so that they cannot replace them
+	if !isExpandingAlias() {
+		cxt.Aliases, cxt.InvalidAliases = addAliasCommands(cmd, loadAliases(os.Args[1:]))
+	}
+
 	return cmd
 }
 
@@ -151,22 +240,33 @@ func Execute() {
 }
 
 // initConfig reads in config file and ENV variables if set.
+// The config file is --config, CARINA_CONFIG, or the first config.[toml|yaml|yml|json] found in CARINA_HOME, $XDG_CONFIG_HOME/carina or ~/.carina
 func initConfig() {
-	if cxt.ConfigFile != "" {
-		common.Log.WriteDebug("CONFIG: --config %s", cxt.ConfigFile)
-		viper.SetConfigFile(cxt.ConfigFile)
-
-		err := viper.ReadInConfig()
+	configFile := cxt.ConfigFile
+	if configFile != "" {
+		common.Log.WriteDebug("Config: --config")
+	} else {
+		// Copy a config file from ~/.carina to CARINA_HOME or XDG_CONFIG_HOME, before it is read
+		_, err := client.MigrateConfigFile()
 		if err != nil {
-			common.Log.WriteError("Unable to read configuration file: %s", err, cxt.ConfigFile)
+			common.Log.WriteWarning("%s", err)
 		}
-	} else {
-		viper.SetConfigName("config")
-		viper.AddConfigPath("$HOME/.carina")
 
-		err := viper.ReadInConfig()
+		configFile, err = client.FindConfigFile()
 		if err != nil {
-			common.Log.WriteDebug("CONFIG: %s", cxt.ConfigFile)
+			common.Log.WriteWarning("Unable to find the config file: %s", err)
+			return
 		}
+		if configFile == "" {
+			common.Log.WriteDebug("Config: none found")
+			return
+		}
+	}
+
+	common.Log.WriteDebug("Config: %s", configFile)
+	viper.SetConfigFile(configFile)
+	err := viper.ReadInConfig()
+	if err != nil {
+		common.Log.WriteError("Unable to read configuration file: %s", err, configFile)
 	}
 }
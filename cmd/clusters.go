@@ -1,30 +1,120 @@
 package cmd
 
 import (
+	"errors"
+
+	"github.com/getcarina/carina/client"
+	"github.com/getcarina/carina/common"
 	"github.com/getcarina/carina/console"
 	"github.com/spf13/cobra"
 )
 
 func newClustersCommand() *cobra.Command {
+	var options struct {
+		profiles    []string
+		allProfiles bool
+		regions     []string
+	}
+
+	isMultiAccount := func() bool {
+		return options.allProfiles || len(options.profiles) > 0 || len(options.regions) > 0
+	}
+
 	var cmd = &cobra.Command{
-		Use:               "clusters",
-		Aliases:           []string{"list", "ls"},
-		Short:             "List clusters",
-		Long:              "List clusters",
-		PersistentPreRunE: authenticatedPreRunE,
+		Use:     "clusters",
+		Aliases: []string{"list", "ls"},
+		Short:   "List clusters",
+		Long:    "List clusters, optionally across multiple profiles and regions",
+		Example: `  carina ls
+  carina ls --profiles dev,prod
+  carina ls --all-profiles
+  carina ls --regions DFW,IAD`,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if options.allProfiles && len(options.profiles) > 0 {
+				return errors.New("Use either --profiles or --all-profiles, not both")
+			}
+
+			// Listing other profiles does not require credentials for the current account
+			if options.allProfiles || len(options.profiles) > 0 {
+				cxt.initializeLogging()
+				err := cxt.initializeCassette()
+				if err != nil {
+					return err
+				}
+				cxt.Client = client.NewClient(cxt.CacheEnabled)
+				return checkIsLatest()
+			}
+
+			return authenticatedPreRunE(cmd, args)
+		},
 		RunE: func(cmd *cobra.Command, args []string) error {
-			clusters, err := cxt.Client.ListClusters(cxt.Account)
+			if !isMultiAccount() {
+				clusters, err := cxt.Client.ListClusters(cxt.Account)
+				if err != nil {
+					return err
+				}
+
+				console.WriteClusters(clusters)
+				return nil
+			}
+
+			var accounts []profileAccount
+			var err error
+			switch {
+			case options.allProfiles:
+				accounts, err = cxt.buildProfileAccounts(listProfiles(), options.regions)
+			case len(options.profiles) > 0:
+				accounts, err = cxt.buildProfileAccounts(options.profiles, options.regions)
+			default:
+				accounts = cxt.buildRegionAccounts(options.regions)
+			}
 			if err != nil {
 				return err
 			}
+			if len(accounts) == 0 {
+				return errors.New("No profiles found")
+			}
 
-			console.WriteClusters(clusters)
-
-			return nil
+			return listClustersForAccounts(accounts)
 		},
 	}
 
+	cmd.Flags().StringSliceVar(&options.profiles, "profiles", nil, "List clusters from multiple profiles, e.g. --profiles dev,prod")
+	cmd.Flags().BoolVar(&options.allProfiles, "all-profiles", false, "List clusters from every profile in the config file")
+	cmd.Flags().StringSliceVar(&options.regions, "regions", nil, "List clusters from multiple regions, e.g. --regions DFW,IAD")
 	cmd.SetUsageTemplate(cmd.UsageTemplate())
 
 	return cmd
 }
+
+// listClustersForAccounts queries each account concurrently and prints a single table.
+// Accounts which cannot be reached are reported as warnings, and only fail the command when every account fails.
+func listClustersForAccounts(accounts []profileAccount) error {
+	var clientAccounts []client.Account
+	for _, account := range accounts {
+		clientAccounts = append(clientAccounts, account.Account)
+	}
+
+	var results []console.SourcedClusters
+	var lastErr error
+	for i, result := range cxt.Client.ListClustersForAccounts(clientAccounts) {
+		if result.Error != nil {
+			common.Log.WriteWarning("Unable to list clusters for profile %s in region %s: %s", accounts[i].Profile, accounts[i].Region, result.Error)
+			lastErr = result.Error
+			continue
+		}
+
+		results = append(results, console.SourcedClusters{
+			Profile:  accounts[i].Profile,
+			Region:   accounts[i].Region,
+			Clusters: result.Clusters,
+		})
+	}
+
+	if len(results) == 0 {
+		return lastErr
+	}
+
+	console.WriteSourcedClusters(results)
+	return nil
+}
@@ -21,18 +21,46 @@ func bindClusterNameArg(args []string, name *string) error {
 	return nil
 }
 
+// bindActiveClusterNameArg binds the cluster name argument, falling back to the cluster selected with carina use
+func bindActiveClusterNameArg(args []string, name *string) error {
+	if len(args) > 0 {
+		*name = args[0]
+		return nil
+	}
+
+	active, ok := cxt.Client.Cache.GetActiveCluster(cxt.Account)
+	if !ok {
+		return errors.New("A cluster name is required. Specify one or select a cluster with carina use <cluster-name>")
+	}
+
+	common.Log.WriteDebug("Cluster: %s (selected with carina use)", active.Name)
+	*name = active.Name
+	return nil
+}
+
 func authenticatedPreRunE(cmd *cobra.Command, args []string) error {
 	err := cxt.initialize()
 	if err != nil {
 		return err
 	}
 
+	// The profile is known once the context is initialized, so its defaults can be applied
+	err = applyFlagDefaults(cmd, cxt.Profile)
+	if err != nil {
+		return err
+	}
+
 	return checkIsLatest()
 }
 
 func unauthenticatedPreRunE(cmd *cobra.Command, args []string) error {
 	cxt.Client = client.NewClient(cxt.CacheEnabled)
 
+	err := applyFlagDefaults(cmd, "")
+	if err != nil {
+		return err
+	}
+
 	return checkIsLatest()
 }
 
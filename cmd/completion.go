@@ -0,0 +1,427 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/getcarina/carina/common"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// clusterNameArg is the ValidArgs placeholder for commands whose first argument is an existing cluster.
+// Those arguments are completed dynamically with the names of the clusters on the account.
+const clusterNameArg = "cluster-name"
+
+// completionKinds are the values which can be completed dynamically with carina __complete
+var completionKinds = []string{"clusters", "templates", "profiles"}
+
+func newCompletionCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "completion <shell>",
+		Short: "Generate shell completion for the carina cli",
+		Long: `Generate shell completion for the carina cli. Allowed values: bash, zsh, fish, powershell.
+
+Cluster names and the values of --template and --profile are completed dynamically. The cluster and template names are cached next to cache.json for a minute, so that completion stays responsive.`,
+		Example: `  # bash, add to ~/.bashrc
+  source <(carina completion bash)
+
+  # zsh, add to ~/.zshrc
+  source <(carina completion zsh)
+
+  # fish
+  carina completion fish > ~/.config/fish/completions/carina.fish
+
+  # powershell, add to $PROFILE
+  carina completion powershell | Out-String | Invoke-Expression`,
+		PersistentPreRunE: unauthenticatedPreRunE,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) < 1 {
+				return fmt.Errorf("A shell is required. Allowed values are bash, zsh, fish and powershell")
+			}
+
+			root := cmd.Root()
+			switch args[0] {
+			case "bash":
+				return writeBashCompletion(root, os.Stdout)
+			case "zsh":
+				return writeZshCompletion(root, os.Stdout)
+			case "fish":
+				return writeFishCompletion(root, os.Stdout)
+			case "powershell":
+				return writePowerShellCompletion(root, os.Stdout)
+			default:
+				return fmt.Errorf("Invalid shell: %s. Allowed values are bash, zsh, fish and powershell", args[0])
+			}
+		},
+	}
+
+	cmd.SetUsageTemplate(cmd.UsageTemplate())
+
+	return cmd
+}
+
+// newCompleteCommand is called by the generated completion scripts to look up cluster, template and profile names
+func newCompleteCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:    "__complete <clusters|templates|profiles>",
+		Short:  "Print values for shell completion",
+		Hidden: true,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			// Never print warnings into the user's shell while they are typing
+			cxt.Silent = true
+			if len(args) > 0 && args[0] == "profiles" {
+				cxt.initializeLogging()
+				return nil
+			}
+			return cxt.initialize()
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) < 1 {
+				return fmt.Errorf("A completion kind is required. Allowed values are %s", strings.Join(completionKinds, ", "))
+			}
+
+			var names []string
+			var err error
+			switch args[0] {
+			case "clusters":
+				names, err = cxt.Client.ListClusterNames(cxt.Account)
+			case "templates":
+				names, err = cxt.Client.ListClusterTemplateNames(cxt.Account)
+			case "profiles":
+				names = listProfiles()
+				sort.Strings(names)
+			default:
+				return fmt.Errorf("Invalid completion kind: %s. Allowed values are %s", args[0], strings.Join(completionKinds, ", "))
+			}
+			if err != nil {
+				common.Log.WriteDebug("Unable to complete %s: %s", args[0], err)
+				return nil
+			}
+
+			for _, name := range names {
+				fmt.Println(name)
+			}
+			return nil
+		},
+	}
+
+	cmd.SetUsageTemplate(cmd.UsageTemplate())
+
+	return cmd
+}
+
+// dynamicCompletionFlags maps the flags whose values are completed dynamically to their completion kind
+var dynamicCompletionFlags = map[string]string{
+	"profile":  "profiles",
+	"template": "templates",
+}
+
+// markDynamicCompletionFlags registers the bash completion functions for flags with dynamic values
+func markDynamicCompletionFlags(root *cobra.Command) {
+	mark := func(flags *pflag.FlagSet) {
+		for name, kind := range dynamicCompletionFlags {
+			if flags.Lookup(name) != nil {
+				cobra.MarkFlagCustom(flags, name, "__carina_complete_"+kind)
+			}
+		}
+	}
+
+	mark(root.PersistentFlags())
+	visitCommands(root, func(cmd *cobra.Command) {
+		mark(cmd.LocalNonPersistentFlags())
+	})
+}
+
+// visitCommands walks the available commands below root, depth first
+func visitCommands(root *cobra.Command, fn func(*cobra.Command)) {
+	for _, cmd := range root.Commands() {
+		if !cmd.IsAvailableCommand() {
+			continue
+		}
+		fn(cmd)
+		visitCommands(cmd, fn)
+	}
+}
+
+func takesClusterName(cmd *cobra.Command) bool {
+	return len(cmd.ValidArgs) > 0 && cmd.ValidArgs[0] == clusterNameArg
+}
+
+// commandPath is the command path without the root command, e.g. "credentials export"
+func commandPath(cmd *cobra.Command) string {
+	return strings.TrimPrefix(cmd.CommandPath(), cmd.Root().Name()+" ")
+}
+
+func isCompletableFlag(flag *pflag.Flag) bool {
+	return !flag.Hidden && flag.Deprecated == "" && flag.Name != "help"
+}
+
+// completionFlags lists the flags which can be completed for a command, including inherited flags
+func completionFlags(cmd *cobra.Command) []*pflag.Flag {
+	var flags []*pflag.Flag
+	visit := func(flag *pflag.Flag) {
+		if isCompletableFlag(flag) {
+			flags = append(flags, flag)
+		}
+	}
+	cmd.NonInheritedFlags().VisitAll(visit)
+	cmd.InheritedFlags().VisitAll(visit)
+	return flags
+}
+
+const bashCompletionFunction = `__carina_profile_args()
+{
+    local i
+    for (( i=1; i < ${#words[@]}; i++ )); do
+        case ${words[i]} in
+            --profile=*)
+                echo "${words[i]}"
+                return
+                ;;
+            --profile)
+                echo "--profile=${words[i+1]}"
+                return
+                ;;
+        esac
+    done
+}
+
+__carina_complete()
+{
+    local names
+    names=$(carina __complete "$1" $(__carina_profile_args) 2>/dev/null)
+    COMPREPLY=( $(compgen -W "${names}" -- "$cur") )
+}
+
+__carina_complete_clusters()
+{
+    __carina_complete clusters
+}
+
+__carina_complete_templates()
+{
+    __carina_complete templates
+}
+
+__carina_complete_profiles()
+{
+    __carina_complete profiles
+}
+`
+
+// writeBashCompletion generates the cobra bash completion, extended to complete cluster names dynamically
+func writeBashCompletion(root *cobra.Command, w io.Writer) error {
+	var clusterCommands []string
+	visitCommands(root, func(cmd *cobra.Command) {
+		if takesClusterName(cmd) {
+			clusterCommands = append(clusterCommands, strings.Replace(cmd.CommandPath(), " ", "_", -1))
+		}
+
+		// ValidArgs hold placeholders such as cluster-name, which bash would otherwise offer as literal completions
+		cmd.ValidArgs = nil
+	})
+
+	markDynamicCompletionFlags(root)
+	root.BashCompletionFunction = bashCompletionFunction
+	if len(clusterCommands) > 0 {
+		root.BashCompletionFunction += fmt.Sprintf(`
+__custom_func()
+{
+    case ${last_command} in
+        %s)
+            __carina_complete_clusters
+            ;;
+    esac
+}
+`, strings.Join(clusterCommands, "|"))
+	}
+
+	return root.GenBashCompletion(w)
+}
+
+// writeZshCompletion wraps the bash completion with bashcompinit, so that both shells share the dynamic completion
+func writeZshCompletion(root *cobra.Command, w io.Writer) error {
+	var bash bytes.Buffer
+	err := writeBashCompletion(root, &bash)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(w, "#compdef carina")
+	fmt.Fprintln(w, "autoload -U +X bashcompinit && bashcompinit")
+	_, err = bash.WriteTo(w)
+	return err
+}
+
+const fishCompletionPreamble = `# fish completion for carina
+function __carina_complete
+    set -l tokens (commandline -opc)
+    set -l args __complete $argv
+    if set -l i (contains -i -- --profile $tokens)
+        set args $args --profile $tokens[(math $i + 1)]
+    end
+    carina $args 2>/dev/null
+end
+
+complete -c carina -f
+`
+
+// writeFishCompletion generates fish completion by walking the command tree
+func writeFishCompletion(root *cobra.Command, w io.Writer) error {
+	var buf bytes.Buffer
+	buf.WriteString(fishCompletionPreamble)
+
+	for _, flag := range completionFlags(root) {
+		buf.WriteString(fishFlag("", flag))
+	}
+
+	visitCommands(root, func(cmd *cobra.Command) {
+		// Offer the command once its parent has been typed, and before any of its siblings
+		condition := "__fish_use_subcommand"
+		if cmd.Parent() != root {
+			var siblings []string
+			for _, sibling := range cmd.Parent().Commands() {
+				siblings = append(siblings, sibling.Name())
+			}
+			condition = fmt.Sprintf("__fish_seen_subcommand_from %s; and not __fish_seen_subcommand_from %s", cmd.Parent().Name(), strings.Join(siblings, " "))
+		}
+		buf.WriteString(fmt.Sprintf("complete -c carina -n '%s' -a %s -d %s\n", condition, cmd.Name(), fishQuote(cmd.Short)))
+
+		seen := "__fish_seen_subcommand_from " + cmd.Name()
+		cmd.NonInheritedFlags().VisitAll(func(flag *pflag.Flag) {
+			if isCompletableFlag(flag) {
+				buf.WriteString(fishFlag(seen, flag))
+			}
+		})
+		if takesClusterName(cmd) {
+			buf.WriteString(fmt.Sprintf("complete -c carina -n '%s' -a '(__carina_complete clusters)'\n", seen))
+		}
+	})
+
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+func fishFlag(condition string, flag *pflag.Flag) string {
+	line := "complete -c carina"
+	if condition != "" {
+		line += fmt.Sprintf(" -n '%s'", condition)
+	}
+	line += " -l " + flag.Name
+	if flag.Shorthand != "" {
+		line += " -s " + flag.Shorthand
+	}
+	if kind, ok := dynamicCompletionFlags[flag.Name]; ok {
+		line += fmt.Sprintf(" -x -a '(__carina_complete %s)'", kind)
+	} else if flag.Value.Type() != "bool" {
+		line += " -r"
+	}
+	return line + " -d " + fishQuote(flag.Usage) + "\n"
+}
+
+func fishQuote(value string) string {
+	return "'" + strings.Replace(value, "'", `\'`, -1) + "'"
+}
+
+const powerShellCompletionTemplate = `# powershell completion for carina
+Register-ArgumentCompleter -Native -CommandName 'carina' -ScriptBlock {
+    param($wordToComplete, $commandAst, $cursorPosition)
+
+    $commands = @{
+%s    }
+    $valueFlags = @(%s)
+
+    $tokens = @($commandAst.CommandElements | Select-Object -Skip 1 | ForEach-Object { $_.ToString() })
+    if ($wordToComplete -and $tokens.Count -gt 0) {
+        $tokens = @($tokens | Select-Object -First ($tokens.Count - 1))
+    }
+
+    # Find the command being completed, the profile and how many arguments have been typed
+    $path = ''
+    $profileArgs = @()
+    $argCount = 0
+    $prev = ''
+    foreach ($token in $tokens) {
+        if ($prev -eq '--profile') {
+            $profileArgs = @('--profile', $token)
+        } elseif ($valueFlags -contains $prev) {
+        } elseif (-not $token.StartsWith('-')) {
+            $next = ("$path $token").Trim()
+            if ($commands.ContainsKey($next)) { $path = $next } else { $argCount++ }
+        }
+        $prev = $token
+    }
+
+    $command = $commands[$path]
+    if ($prev -eq '--profile') {
+        $values = carina __complete profiles 2>$null
+    } elseif ($prev -eq '--template') {
+        $values = carina __complete templates @profileArgs 2>$null
+    } elseif ($wordToComplete.StartsWith('-')) {
+        $values = $command.Flags
+    } elseif ($command.Clusters -and $argCount -eq 0) {
+        $values = carina __complete clusters @profileArgs 2>$null
+    } else {
+        $values = $command.Commands
+    }
+
+    $values | Where-Object { $_ -like "$wordToComplete*" } | ForEach-Object {
+        [System.Management.Automation.CompletionResult]::new($_, $_, 'ParameterValue', $_)
+    }
+}
+`
+
+// writePowerShellCompletion generates PowerShell completion by walking the command tree
+func writePowerShellCompletion(root *cobra.Command, w io.Writer) error {
+	var commands bytes.Buffer
+	valueFlags := make(map[string]bool)
+
+	writeCommand := func(cmd *cobra.Command) {
+		var subcommands []string
+		for _, subcommand := range cmd.Commands() {
+			if subcommand.IsAvailableCommand() {
+				subcommands = append(subcommands, subcommand.Name())
+			}
+		}
+
+		var flags []string
+		for _, flag := range completionFlags(cmd) {
+			flags = append(flags, "--"+flag.Name)
+			if flag.Value.Type() != "bool" {
+				valueFlags["--"+flag.Name] = true
+			}
+		}
+
+		path := ""
+		if cmd != root {
+			path = commandPath(cmd)
+		}
+		commands.WriteString(fmt.Sprintf("        '%s' = @{ Commands = @(%s); Flags = @(%s); Clusters = $%t }\n",
+			path, powerShellList(subcommands), powerShellList(flags), takesClusterName(cmd)))
+	}
+
+	writeCommand(root)
+	visitCommands(root, writeCommand)
+
+	var flags []string
+	for flag := range valueFlags {
+		flags = append(flags, flag)
+	}
+	sort.Strings(flags)
+
+	_, err := fmt.Fprintf(w, powerShellCompletionTemplate, commands.String(), powerShellList(flags))
+	return err
+}
+
+func powerShellList(values []string) string {
+	quoted := make([]string, len(values))
+	for i, value := range values {
+		quoted[i] = "'" + strings.Replace(value, "'", "''", -1) + "'"
+	}
+	return strings.Join(quoted, ", ")
+}
@@ -0,0 +1,31 @@
+package cmd
+
+import (
+	"github.com/getcarina/carina/client"
+	"github.com/spf13/cobra"
+)
+
+// secretProfileSettings are the profile settings which may be encrypted in the config file
+var secretProfileSettings = []string{"apikey", "password", "application-credential-secret", "token"}
+
+func newConfigCommand() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "config",
+		Short: "Manage the config file",
+		Long:  "Manage the config file which holds your profiles. See carina --help for where it is found",
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			// Skip authentication and the release check, the profiles are not used
+			cxt.initializeLogging()
+			cxt.Client = client.NewClient(cxt.CacheEnabled)
+			return nil
+		},
+	}
+
+	cmd.AddCommand(
+		newConfigEncryptCommand(),
+	)
+
+	cmd.SetUsageTemplate(cmd.UsageTemplate())
+
+	return cmd
+}
@@ -0,0 +1,201 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/getcarina/carina/client"
+	"github.com/getcarina/carina/common"
+	"github.com/getcarina/carina/console"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// secretSettingPattern matches a secret profile setting with a quoted value, e.g. apikey = "abc123" # comment
+var secretSettingPattern = regexp.MustCompile(`^(\s*)(` + strings.Join(secretProfileSettings, "|") + `)(\s*=\s*)("(?:[^"\\]|\\.)*"|'[^']*')(.*)$`)
+
+func newConfigEncryptCommand() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "encrypt",
+		Short: "Encrypt the secrets in the config file and cache",
+		Long: fmt.Sprintf(`Encrypt the secrets in the config file and cache with the passphrase from %s.
+
+The apikey and password of each profile are encrypted in place, and the config file is made readable only by you. Cached tokens are encrypted as well.
+
+Once encrypted, %s must be set whenever carina uses a profile with an encrypted secret. Tokens are cached encrypted, and are ignored when the passphrase is not set.`,
+			client.CarinaSecretsPassphraseEnvVar, client.CarinaSecretsPassphraseEnvVar),
+		Example: fmt.Sprintf(`  export %s=ilovepuppies
+  carina config encrypt`, client.CarinaSecretsPassphraseEnvVar),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			passphrase := os.Getenv(client.CarinaSecretsPassphraseEnvVar)
+			if passphrase == "" {
+				return fmt.Errorf("%s must be set to the passphrase used to encrypt the secrets", client.CarinaSecretsPassphraseEnvVar)
+			}
+
+			configFile := viper.ConfigFileUsed()
+			if configFile == "" {
+				common.Log.WriteDebug("Skipping the config file, none was found")
+			} else {
+				count, err := encryptConfigFile(configFile, passphrase)
+				if err != nil {
+					return err
+				}
+				console.Write("Encrypted %d secrets in %s", count, configFile)
+			}
+
+			if cxt.Client.Cache.Path() == "" {
+				common.Log.WriteDebug("Skipping the cache, it is disabled")
+				return nil
+			}
+
+			count, err := cxt.Client.Cache.EncryptSecrets()
+			if err != nil {
+				return err
+			}
+			console.Write("Encrypted %d cached tokens", count)
+
+			return nil
+		},
+	}
+
+	cmd.SetUsageTemplate(cmd.UsageTemplate())
+
+	return cmd
+}
+
+// encryptConfigFile encrypts the secrets in a config file, returning how many were encrypted.
+// The encrypted secrets are verified before the file is atomically replaced, no unencrypted copy is kept.
+func encryptConfigFile(path string, passphrase string) (int, error) {
+	if strings.ToLower(filepath.Ext(path)) != ".toml" {
+		return 0, fmt.Errorf("Unable to encrypt %s, only TOML config files are supported", path)
+	}
+
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, errors.Wrapf(err, "Unable to read the config file %s", path)
+	}
+
+	encrypted, count, err := encryptConfigSecrets(contents, passphrase)
+	if err != nil {
+		return 0, errors.Wrapf(err, "Unable to encrypt %s", path)
+	}
+
+	// Restrict the permissions, even when there was nothing to encrypt, as the file may hold other secrets
+	err = os.Chmod(path, 0600)
+	if err != nil {
+		return 0, errors.Wrapf(err, "Unable to set the permissions on %s", path)
+	}
+
+	if count == 0 {
+		return 0, nil
+	}
+
+	err = verifyEncryptedConfig(contents, encrypted, passphrase)
+	if err != nil {
+		return 0, errors.Wrapf(err, "Unable to encrypt %s, it was left unchanged", path)
+	}
+
+	err = client.WriteFileAtomic(path, encrypted, 0600)
+	if err != nil {
+		return 0, errors.Wrapf(err, "Unable to write the config file %s", path)
+	}
+
+	return count, nil
+}
+
+// verifyEncryptedConfig checks that the encrypted config file is read the same as the original, once its secrets are decrypted
+func verifyEncryptedConfig(original []byte, encrypted []byte, passphrase string) error {
+	want, err := readConfigSections(original)
+	if err != nil {
+		return err
+	}
+
+	got, err := readConfigSections(encrypted)
+	if err != nil {
+		return errors.Wrap(err, "The encrypted config file cannot be read")
+	}
+
+	for section, settings := range want {
+		for key, value := range settings {
+			decrypted := got[section][key]
+			if common.IsEncryptedString(decrypted) && !common.IsEncryptedString(value) {
+				decrypted, err = common.DecryptString(decrypted, passphrase)
+				if err != nil {
+					return errors.Wrapf(err, "Unable to decrypt the %s setting of %s", key, section)
+				}
+			}
+			if decrypted != value {
+				return fmt.Errorf("The %s setting of %s changed when it was encrypted", key, section)
+			}
+		}
+	}
+
+	return nil
+}
+
+// readConfigSections reads the settings of each section of a TOML config file
+func readConfigSections(contents []byte) (map[string]map[string]string, error) {
+	config := viper.New()
+	config.SetConfigType("toml")
+	if err := config.ReadConfig(bytes.NewReader(contents)); err != nil {
+		return nil, err
+	}
+
+	sections := make(map[string]map[string]string)
+	for name, value := range config.AllSettings() {
+		if _, ok := value.(map[string]interface{}); ok {
+			sections[name] = config.GetStringMapString(name)
+		}
+	}
+	return sections, nil
+}
+
+// encryptConfigSecrets encrypts the secret settings in a TOML config file, line by line so that comments and formatting are kept
+func encryptConfigSecrets(contents []byte, passphrase string) ([]byte, int, error) {
+	var result bytes.Buffer
+	var count int
+
+	scanner := bufio.NewScanner(bytes.NewReader(contents))
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		match := secretSettingPattern.FindStringSubmatch(line)
+		if match != nil {
+			indent, key, separator, quoted, trailing := match[1], match[2], match[3], match[4], match[5]
+
+			value := strings.Trim(quoted, "'")
+			if strings.HasPrefix(quoted, `"`) {
+				var err error
+				value, err = strconv.Unquote(quoted)
+				if err != nil {
+					return nil, 0, errors.Wrapf(err, "Unable to read the %s setting", key)
+				}
+			}
+
+			if value != "" && !common.IsEncryptedString(value) {
+				encrypted, err := common.EncryptString(value, passphrase)
+				if err != nil {
+					return nil, 0, err
+				}
+				line = fmt.Sprintf("%s%s%s%q%s", indent, key, separator, encrypted, trailing)
+				count++
+			}
+		}
+
+		result.WriteString(line)
+		result.WriteString("\n")
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return result.Bytes(), count, nil
+}
@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/getcarina/carina/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncryptConfigFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "carina-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config.toml")
+	contents := `[dfw]
+cloud = "public"
+username = "alice"
+apikey = "abc123" # comment
+
+[private]
+cloud = "private"
+password = 'p@ss"word'
+`
+	err = ioutil.WriteFile(path, []byte(contents), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	count, err := encryptConfigFile(path, "ilovepuppies")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 2, count)
+
+	encrypted, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NotContains(t, string(encrypted), "abc123")
+	assert.Contains(t, string(encrypted), "# comment")
+
+	sections, err := readConfigSections(encrypted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	apikey, err := common.DecryptString(sections["dfw"]["apikey"], "ilovepuppies")
+	assert.NoError(t, err)
+	assert.Equal(t, "abc123", apikey)
+	password, err := common.DecryptString(sections["private"]["password"], "ilovepuppies")
+	assert.NoError(t, err)
+	assert.Equal(t, `p@ss"word`, password)
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, files, 1, "Expected no unencrypted copy of the config file")
+}
+
+func TestVerifyEncryptedConfigDetectsChanges(t *testing.T) {
+	original := []byte("[dfw]\napikey = \"abc123\"\n")
+	encrypted := []byte("[dfw]\napikey = \"xyz789\"\n")
+
+	err := verifyEncryptedConfig(original, encrypted, "ilovepuppies")
+	assert.Error(t, err)
+}
@@ -1,10 +1,11 @@
 package cmd
 
 import (
-	"errors"
 	"fmt"
-
 	"os"
+	"sort"
+	"strconv"
+	"time"
 
 	"github.com/getcarina/carina/client"
 	"github.com/getcarina/carina/common"
@@ -12,6 +13,8 @@ import (
 	"github.com/getcarina/carina/make-coe"
 	"github.com/getcarina/carina/makeswarm"
 	"github.com/getcarina/carina/version"
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 )
 
@@ -69,11 +72,53 @@ const RackspaceRegionEnvVar = "RS_REGION_NAME"
 // OpenStackRegionEnvVar is the OpenStack region name
 const OpenStackRegionEnvVar = "OS_REGION_NAME"
 
+// OpenStackUserIDEnvVar is the OpenStack user id, used instead of the username and user domain
+const OpenStackUserIDEnvVar = "OS_USER_ID"
+
+// OpenStackProjectIDEnvVar is the OpenStack project id, used instead of the project name and project domain
+const OpenStackProjectIDEnvVar = "OS_PROJECT_ID"
+
+// OpenStackUserDomainIDEnvVar is the OpenStack _user_ domain id
+const OpenStackUserDomainIDEnvVar = "OS_USER_DOMAIN_ID"
+
+// OpenStackProjectDomainIDEnvVar is the OpenStack _project_ domain id
+const OpenStackProjectDomainIDEnvVar = "OS_PROJECT_DOMAIN_ID"
+
+// OpenStackApplicationCredentialIDEnvVar is the id of an OpenStack application credential, used instead of a username and password
+const OpenStackApplicationCredentialIDEnvVar = "OS_APPLICATION_CREDENTIAL_ID"
+
+// OpenStackApplicationCredentialSecretEnvVar is the secret of an OpenStack application credential
+const OpenStackApplicationCredentialSecretEnvVar = "OS_APPLICATION_CREDENTIAL_SECRET"
+
+// OpenStackTokenEnvVar is a pre-issued OpenStack token, used instead of authenticating
+const OpenStackTokenEnvVar = "OS_TOKEN"
+
+// OpenStackTenantEnvVar is the OpenStack tenant name, the identity v2 equivalent of the project name
+const OpenStackTenantEnvVar = "OS_TENANT_NAME"
+
+// OpenStackInterfaceEnvVar selects the endpoint from the OpenStack service catalog: public, internal or admin
+const OpenStackInterfaceEnvVar = "OS_INTERFACE"
+
+// OpenStackCACertEnvVar is the OpenStack CA certificate bundle
+const OpenStackCACertEnvVar = "OS_CACERT"
+
+// OpenStackCertEnvVar is the OpenStack client certificate
+const OpenStackCertEnvVar = "OS_CERT"
+
+// OpenStackKeyEnvVar is the OpenStack client certificate key
+const OpenStackKeyEnvVar = "OS_KEY"
+
+// OpenStackCloudEnvVar is the name of a cloud in clouds.yaml
+const OpenStackCloudEnvVar = "OS_CLOUD"
+
 type context struct {
 	// Values built from flags
 	Client  *client.Client
 	Account client.Account
 
+	// flags are the global flags, used to tell when a flag was explicitly set to its default value
+	flags *pflag.FlagSet
+
 	// Global Flags
 	CacheEnabled bool
 	ConfigFile   string
@@ -92,6 +137,38 @@ type context struct {
 	Region           string
 	AuthEndpoint     string
 	EndpointOverride string
+
+	// HTTP Flags
+	HTTP           common.HTTPOptions
+	Retries        int
+	Timeout        time.Duration
+	ConnectTimeout time.Duration
+	Record         string
+	Replay         string
+
+	// Private Cloud Flags
+	OSCloud   string
+	Interface string
+
+	// Private Cloud identity v3 settings, read from profiles, clouds.yaml and environment variables
+	UserID                      string
+	ProjectID                   string
+	UserDomain                  string
+	UserDomainID                string
+	ProjectDomain               string
+	ProjectDomainID             string
+	ApplicationCredentialID     string
+	ApplicationCredentialSecret string
+	Token                       string
+
+	// Private Cloud Credentials Flags
+	CSR           bool
+	CSRKeyType    string
+	CSRCommonName string
+
+	// Aliases from the config file, and the aliases which were skipped with the reason
+	Aliases        map[string]string
+	InvalidAliases map[string]string
 }
 
 func (cxt *context) shouldTryProfile() bool {
@@ -113,6 +190,11 @@ func (cxt *context) shouldTryProfile() bool {
 	return configExists
 }
 
+// flagChanged checks if a global flag was specified, even when set to its default value, e.g. --csr=false
+func (cxt *context) flagChanged(name string) bool {
+	return cxt.flags != nil && cxt.flags.Changed(name)
+}
+
 func (cxt *context) userSpecifiedAuthFlagsExist() bool {
 	return cxt.CloudType != "" ||
 		cxt.Username != "" ||
@@ -120,7 +202,8 @@ func (cxt *context) userSpecifiedAuthFlagsExist() bool {
 		cxt.APIKey != "" ||
 		cxt.Domain != "" ||
 		cxt.Project != "" ||
-		cxt.Region != ""
+		cxt.Region != "" ||
+		cxt.OSCloud != ""
 }
 
 func (cxt *context) buildAccount() client.Account {
@@ -131,11 +214,13 @@ func (cxt *context) buildAccount() client.Account {
 			UserName:         cxt.Username,
 			APIKey:           cxt.APIKey,
 			Region:           cxt.Region,
+			HTTP:             cxt.HTTP,
 		}
 	case client.CloudMakeSwarm:
 		return &makeswarm.Account{
 			UserName: cxt.Username,
 			APIKey:   cxt.APIKey,
+			HTTP:     cxt.HTTP,
 		}
 	case client.CloudMagnum:
 		return &magnum.Account{
@@ -145,22 +230,69 @@ func (cxt *context) buildAccount() client.Account {
 			Password:         cxt.Password,
 			Project:          cxt.Project,
 			Domain:           cxt.Domain,
+			Region:           cxt.Region,
+			Interface:        cxt.Interface,
+			HTTP:             cxt.HTTP,
+
+			UserID:                      cxt.UserID,
+			ProjectID:                   cxt.ProjectID,
+			UserDomain:                  cxt.UserDomain,
+			UserDomainID:                cxt.UserDomainID,
+			ProjectDomain:               cxt.ProjectDomain,
+			ProjectDomainID:             cxt.ProjectDomainID,
+			ApplicationCredentialID:     cxt.ApplicationCredentialID,
+			ApplicationCredentialSecret: cxt.ApplicationCredentialSecret,
+			Token:                       cxt.Token,
+			CSR:                         cxt.CSR,
+			CSRKeyType:                  cxt.CSRKeyType,
+			CSRCommonName:               cxt.CSRCommonName,
 		}
 	default:
 		panic(fmt.Sprintf("Unsupported cloud type: %s", cxt.CloudType))
 	}
 }
 
-func (cxt *context) initialize() error {
+func (cxt *context) initializeLogging() {
 	if cxt.Silent {
 		common.Log.SetSilent()
 	} else if cxt.Debug {
 		common.Log.SetDebug()
 		common.Log.WriteDebug("Version: %s (%s)", version.Version, version.Commit)
 	}
+}
 
-	var profileLoaded bool
+// initializeCassette records or replays the HTTP interactions
+func (cxt *context) initializeCassette() error {
 	var err error
+	switch {
+	case cxt.Record != "" && cxt.Replay != "":
+		return errors.New("Use either --record or --replay, not both")
+	case cxt.Record != "":
+		err = common.StartRecording(cxt.Record)
+	case cxt.Replay != "":
+		err = common.StartReplay(cxt.Replay)
+	default:
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// Cached tokens would skip authenticating, so that it is missing from the cassette
+	common.Log.WriteDebug("Disabling the cache while recording or replaying HTTP interactions")
+	cxt.CacheEnabled = false
+	return nil
+}
+
+func (cxt *context) initialize() error {
+	cxt.initializeLogging()
+
+	err := cxt.initializeCassette()
+	if err != nil {
+		return err
+	}
+
+	var profileLoaded bool
 	if cxt.shouldTryProfile() {
 		profileLoaded, err = cxt.loadProfile()
 		if err != nil {
@@ -190,12 +322,64 @@ func (cxt *context) initialize() error {
 		}
 	}
 
+	err = cxt.applyTimeoutFlags()
+	if err != nil {
+		return err
+	}
+	err = cxt.initializeHTTP()
+	if err != nil {
+		return err
+	}
+
 	cxt.Client = client.NewClient(cxt.CacheEnabled)
 	cxt.Account = cxt.buildAccount()
 
 	return nil
 }
 
+// initializeHTTP applies the retry policy, loads the TLS settings, and uses them for the requests which
+// we cannot customize, such as when libcarina authenticates
+func (cxt *context) initializeHTTP() error {
+	if cxt.Retries < 0 {
+		return fmt.Errorf("Invalid --retries value: %d. It must be zero or greater", cxt.Retries)
+	}
+	common.DefaultRetryPolicy.Retries = cxt.Retries
+
+	err := cxt.HTTP.Load()
+	if err != nil {
+		return err
+	}
+
+	cxt.HTTP.TLS.ApplyToDefaultTransport()
+	return nil
+}
+
+// applyTimeoutFlags applies --timeout and --connect-timeout, which take precedence over the profile
+func (cxt *context) applyTimeoutFlags() error {
+	if cxt.flagChanged("timeout") && cxt.Timeout <= 0 {
+		return fmt.Errorf("Invalid --timeout value: %s. It must be greater than zero", cxt.Timeout)
+	}
+	if cxt.flagChanged("connect-timeout") && cxt.ConnectTimeout <= 0 {
+		return fmt.Errorf("Invalid --connect-timeout value: %s. It must be greater than zero", cxt.ConnectTimeout)
+	}
+
+	var flags common.Timeouts
+	if cxt.Timeout > 0 {
+		common.Log.WriteDebug("Timeout: --timeout")
+		flags.Auth = cxt.Timeout
+		flags.API = cxt.Timeout
+		flags.Credentials = cxt.Timeout
+	}
+
+	if cxt.ConnectTimeout > 0 {
+		common.Log.WriteDebug("ConnectTimeout: --connect-timeout")
+		flags.Connect = cxt.ConnectTimeout
+	}
+
+	cxt.HTTP.Timeouts = cxt.HTTP.Timeouts.Override(flags)
+	return nil
+}
+
 func (cxt *context) loadProfile() (ok bool, err error) {
 	common.Log.WriteDebug("Loading profiles")
 	configFile := viper.ConfigFileUsed()
@@ -230,7 +414,13 @@ func (cxt *context) loadProfile() (ok bool, err error) {
 	case client.CloudMagnum:
 		err = cxt.loadMagnumProfile(profile)
 	case "":
-		err = fmt.Errorf("Invalid profile: cloud is missing")
+		if profile["os-cloud"] != "" {
+			// A profile backed by clouds.yaml is always a private cloud
+			cxt.CloudType = client.CloudMagnum
+			err = cxt.loadMagnumProfile(profile)
+		} else {
+			err = fmt.Errorf("Invalid profile: cloud is missing")
+		}
 	default:
 		err = fmt.Errorf("Invalid profile: %s is not a valid cloud type", cxt.CloudType)
 	}
@@ -238,12 +428,126 @@ func (cxt *context) loadProfile() (ok bool, err error) {
 	return err == nil, err
 }
 
+// profileAccount is an account built from a profile, labeled with its source
+type profileAccount struct {
+	Profile string
+	Region  string
+	Account client.Account
+}
+
+// listProfiles returns the names of the profiles defined in the config file
+func listProfiles() []string {
+	var profiles []string
+	for name, value := range viper.AllSettings() {
+		settings, ok := value.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if _, isProfile := settings["cloud"]; isProfile {
+			profiles = append(profiles, name)
+		}
+	}
+	sort.Strings(profiles)
+	return profiles
+}
+
+// buildProfileAccounts builds an account for every combination of the specified profiles and regions.
+// When no regions are specified, the region from each profile is used.
+func (cxt *context) buildProfileAccounts(profiles []string, regions []string) ([]profileAccount, error) {
+	if viper.ConfigFileUsed() == "" {
+		return nil, errors.New("Unable to use multiple profiles, no config file found")
+	}
+
+	// Each account uses the TLS settings from its profile, only the flags apply to the default transport
+	err := cxt.applyTimeoutFlags()
+	if err != nil {
+		return nil, err
+	}
+	err = cxt.initializeHTTP()
+	if err != nil {
+		return nil, err
+	}
+
+	var accounts []profileAccount
+	for _, profile := range profiles {
+		// Load each profile into its own copy of the context, keeping the global flags
+		profileCxt := &context{
+			flags:          cxt.flags,
+			CacheEnabled:   cxt.CacheEnabled,
+			ConfigFile:     cxt.ConfigFile,
+			Debug:          cxt.Debug,
+			Silent:         cxt.Silent,
+			Profile:        profile,
+			CSR:            cxt.CSR,
+			CSRKeyType:     cxt.CSRKeyType,
+			CSRCommonName:  cxt.CSRCommonName,
+			HTTP:           cxt.HTTP,
+			Timeout:        cxt.Timeout,
+			ConnectTimeout: cxt.ConnectTimeout,
+		}
+		ok, err := profileCxt.loadProfile()
+		if err != nil {
+			return nil, errors.Wrapf(err, "Unable to load profile %s", profile)
+		}
+		if !ok {
+			return nil, fmt.Errorf("Profile, %s, not found", profile)
+		}
+		err = profileCxt.applyTimeoutFlags()
+		if err != nil {
+			return nil, err
+		}
+
+		accounts = append(accounts, profileCxt.buildRegionAccounts(regions)...)
+	}
+
+	return accounts, nil
+}
+
+// buildRegionAccounts builds an account for each region, or a single account for the current region when none are specified
+func (cxt *context) buildRegionAccounts(regions []string) []profileAccount {
+	if len(regions) == 0 {
+		regions = []string{cxt.Region}
+	}
+
+	var accounts []profileAccount
+	for _, region := range regions {
+		cxt.Region = region
+		account := profileAccount{
+			Profile: cxt.Profile,
+			Region:  region,
+			Account: cxt.buildAccount(),
+		}
+		if account.Profile == "" {
+			account.Profile = "-"
+		}
+		if account.Region == "" {
+			account.Region = "default"
+		}
+		accounts = append(accounts, account)
+	}
+
+	return accounts
+}
+
 func (cxt *context) detectCloud() error {
 	// Verify that we have enough information: apikey or password
 	apikeyFound := cxt.APIKey != "" || os.Getenv(CarinaAPIKeyEnvVar) != "" || os.Getenv(RackspaceAPIKeyEnvVar) != ""
-	passwordFound := cxt.Password != "" || os.Getenv(OpenStackPasswordEnvVar) != ""
-	if !apikeyFound && !passwordFound {
-		return errors.New("No credentials provided. A --profile, --apikey or --password must be specified or the equivalent environment variables set. Run carina --help for more information.")
+	passwordFound := cxt.Password != "" || os.Getenv(OpenStackPasswordEnvVar) != "" ||
+		os.Getenv(OpenStackApplicationCredentialIDEnvVar) != "" || os.Getenv(OpenStackTokenEnvVar) != ""
+
+	// os-cloud = --os-cloud -> OS_CLOUD
+	if cxt.OSCloud == "" {
+		cxt.OSCloud = os.Getenv(OpenStackCloudEnvVar)
+		if cxt.OSCloud != "" {
+			common.Log.WriteDebug("OSCloud: %s", OpenStackCloudEnvVar)
+		}
+	} else {
+		common.Log.WriteDebug("OSCloud: --os-cloud")
+	}
+	cloudFound := cxt.OSCloud != ""
+
+	if !apikeyFound && !passwordFound && !cloudFound {
+		return errors.New("No credentials provided. A --profile, --os-cloud, --apikey or --password must be specified or the equivalent environment variables set. Run carina --help for more information.")
 	}
 
 	switch cxt.CloudType {
@@ -251,7 +555,7 @@ func (cxt *context) detectCloud() error {
 		break
 	case "":
 		common.Log.WriteDebug("No cloud type specified, detecting with the provided credentials. Use --cloud or --profile to skip detection.")
-		if apikeyFound {
+		if apikeyFound && !cloudFound {
 			cxt.CloudType = client.CloudMakeCOE
 			common.Log.WriteDebug("Cloud: public")
 		} else {
@@ -339,12 +643,30 @@ func (cxt *context) initCarinaFlags() error {
 		common.Log.WriteDebug("Region: --region")
 	}
 
+	cxt.initCarinaTLSFlags()
+
 	return nil
 }
 
 func (cxt *context) initMagnumFlags() error {
-	// auth-endpoint = --auth-endpoint -> OS_AUTH_URL
-	if cxt.AuthEndpoint == "" {
+	// Settings from clouds.yaml take precedence over the environment variables
+	cloud := &client.CloudConfig{}
+	var cloudSource string
+	if cxt.OSCloud != "" {
+		var err error
+		cloud, err = client.LoadCloudConfig(cxt.OSCloud)
+		if err != nil {
+			return err
+		}
+		cloudSource = fmt.Sprintf("%s in %s", cxt.OSCloud, cloud.Source)
+		common.Log.WriteDebug("Reading cloud %s", cloudSource)
+	}
+
+	// auth-endpoint = --auth-endpoint -> clouds.yaml -> OS_AUTH_URL
+	if cxt.AuthEndpoint == "" && cloud.Auth.AuthURL != "" {
+		cxt.AuthEndpoint = cloud.Auth.AuthURL
+		common.Log.WriteDebug("AuthEndpoint: %s", cloudSource)
+	} else if cxt.AuthEndpoint == "" {
 		cxt.AuthEndpoint = os.Getenv(OpenStackAuthURLEnvVar)
 		if cxt.AuthEndpoint == "" {
 			return fmt.Errorf("AuthEndpoint was not specified via --auth-endpoint or %s", OpenStackAuthURLEnvVar)
@@ -366,30 +688,60 @@ func (cxt *context) initMagnumFlags() error {
 		common.Log.WriteDebug("Endpoint: --endpoint")
 	}
 
-	// username = --username -> OS_USERNAME
-	if cxt.Username == "" {
+	// identity v3 settings = clouds.yaml -> OS_*
+	cxt.initIdentitySetting("UserID", &cxt.UserID, cloud.Auth.UserID, cloudSource, OpenStackUserIDEnvVar)
+	cxt.initIdentitySetting("ProjectID", &cxt.ProjectID, cloud.Auth.ProjectID, cloudSource, OpenStackProjectIDEnvVar)
+	cxt.initIdentitySetting("UserDomain", &cxt.UserDomain, cloud.Auth.UserDomainName, cloudSource, OpenStackUserDomainEnvVar)
+	cxt.initIdentitySetting("UserDomainID", &cxt.UserDomainID, cloud.Auth.UserDomainID, cloudSource, OpenStackUserDomainIDEnvVar)
+	cxt.initIdentitySetting("ProjectDomain", &cxt.ProjectDomain, cloud.Auth.ProjectDomainName, cloudSource, OpenStackProjectDomainEnvVar)
+	cxt.initIdentitySetting("ProjectDomainID", &cxt.ProjectDomainID, cloud.Auth.ProjectDomainID, cloudSource, OpenStackProjectDomainIDEnvVar)
+	cxt.initIdentitySetting("ApplicationCredentialID", &cxt.ApplicationCredentialID, cloud.Auth.ApplicationCredentialID, cloudSource, OpenStackApplicationCredentialIDEnvVar)
+	cxt.initIdentitySetting("ApplicationCredentialSecret", &cxt.ApplicationCredentialSecret, cloud.Auth.ApplicationCredentialSecret, cloudSource, OpenStackApplicationCredentialSecretEnvVar)
+	cxt.initIdentitySetting("Token", &cxt.Token, cloud.Auth.Token, cloudSource, OpenStackTokenEnvVar)
+
+	if cxt.ApplicationCredentialID != "" && cxt.ApplicationCredentialSecret == "" {
+		return fmt.Errorf("ApplicationCredentialSecret was not specified via %s", OpenStackApplicationCredentialSecretEnvVar)
+	}
+
+	// username = --username -> clouds.yaml -> OS_USERNAME
+	if cxt.Username == "" && cloud.Auth.Username != "" {
+		cxt.Username = cloud.Auth.Username
+		common.Log.WriteDebug("UserName: %s", cloudSource)
+	} else if cxt.Username == "" {
 		cxt.Username = os.Getenv(OpenStackUserNameEnvVar)
 		if cxt.Username == "" {
-			return fmt.Errorf("UserName was not specified via --username or %s", OpenStackUserNameEnvVar)
+			if cxt.UserID == "" && !cxt.hasMagnumPasswordlessAuth() {
+				return fmt.Errorf("UserName was not specified via --username or %s", OpenStackUserNameEnvVar)
+			}
+		} else {
+			common.Log.WriteDebug("UserName: %s", OpenStackUserNameEnvVar)
 		}
-		common.Log.WriteDebug("UserName: %s", OpenStackUserNameEnvVar)
 	} else {
 		common.Log.WriteDebug("UserName: --username")
 	}
 
-	// password = --password -> OS_PASSWORD
-	if cxt.Password == "" {
+	// password = --password -> clouds.yaml -> OS_PASSWORD
+	if cxt.Password == "" && cloud.Auth.Password != "" {
+		cxt.Password = cloud.Auth.Password
+		common.Log.WriteDebug("Password: %s", cloudSource)
+	} else if cxt.Password == "" {
 		cxt.Password = os.Getenv(OpenStackPasswordEnvVar)
 		if cxt.Password == "" {
-			return fmt.Errorf("Password was not specified via --password or %s", OpenStackPasswordEnvVar)
+			if !cxt.hasMagnumPasswordlessAuth() {
+				return fmt.Errorf("Password was not specified via --password or %s", OpenStackPasswordEnvVar)
+			}
+		} else {
+			common.Log.WriteDebug("Password: %s", OpenStackPasswordEnvVar)
 		}
-		common.Log.WriteDebug("Password: %s", OpenStackPasswordEnvVar)
 	} else {
 		common.Log.WriteDebug("Password: --password")
 	}
 
-	// project = --project -> OS_PROJECT_NAME
-	if cxt.Project == "" {
+	// project = --project -> clouds.yaml -> OS_PROJECT_NAME
+	if cxt.Project == "" && cloud.Project() != "" {
+		cxt.Project = cloud.Project()
+		common.Log.WriteDebug("Project: %s", cloudSource)
+	} else if cxt.Project == "" {
 		cxt.Project = os.Getenv(OpenStackProjectEnvVar)
 		if cxt.Project == "" {
 			common.Log.WriteDebug("Project was not specified. Either use --project or set %s.", OpenStackProjectEnvVar)
@@ -400,8 +752,11 @@ func (cxt *context) initMagnumFlags() error {
 		common.Log.WriteDebug("Project: --project")
 	}
 
-	// domain = --domain -> OS_PROJECT_DOMAIN_NAME -> OS_USER_DOMAIN_NAME -> OS_DOMAIN_NAME -> "default"
-	if cxt.Domain == "" {
+	// domain = --domain -> clouds.yaml -> OS_PROJECT_DOMAIN_NAME -> OS_USER_DOMAIN_NAME -> OS_DOMAIN_NAME -> "default"
+	if cxt.Domain == "" && cloud.Domain() != "" {
+		cxt.Domain = cloud.Domain()
+		common.Log.WriteDebug("Domain: %s", cloudSource)
+	} else if cxt.Domain == "" {
 		domainVar := OpenStackProjectDomainEnvVar
 		cxt.Domain = os.Getenv(OpenStackProjectDomainEnvVar)
 		if cxt.Domain == "" {
@@ -423,8 +778,11 @@ func (cxt *context) initMagnumFlags() error {
 		common.Log.WriteDebug("Domain: --domain")
 	}
 
-	// region = --region -> OS_REGION_NAME -> "RegionOne"
-	if cxt.Region == "" {
+	// region = --region -> clouds.yaml -> OS_REGION_NAME -> "RegionOne"
+	if cxt.Region == "" && cloud.RegionName != "" {
+		cxt.Region = cloud.RegionName
+		common.Log.WriteDebug("Region: %s", cloudSource)
+	} else if cxt.Region == "" {
 		cxt.Region = os.Getenv(OpenStackRegionEnvVar)
 		if cxt.Region == "" {
 			cxt.Region = "RegionOne"
@@ -436,9 +794,92 @@ func (cxt *context) initMagnumFlags() error {
 		common.Log.WriteDebug("Region: --region")
 	}
 
+	// interface is only read from clouds.yaml
+	if cloud.Interface != "" {
+		cxt.Interface = cloud.Interface
+		common.Log.WriteDebug("Interface: %s", cloudSource)
+	}
+
+	cxt.initTLSFlags(cloud, cloudSource)
+
 	return nil
 }
 
+// initCarinaTLSFlags reads the TLS settings for the public cloud from flags only.
+// OS_CACERT, OS_CERT and OS_KEY are meant for private clouds, and must not change how the public cloud is trusted.
+func (cxt *context) initCarinaTLSFlags() {
+	tlsFlags := []struct {
+		name  string
+		flag  string
+		value string
+	}{
+		{"CACert", "--cacert", cxt.HTTP.TLS.CACert},
+		{"ClientCert", "--client-cert", cxt.HTTP.TLS.ClientCert},
+		{"ClientKey", "--client-key", cxt.HTTP.TLS.ClientKey},
+	}
+	for _, setting := range tlsFlags {
+		if setting.value != "" {
+			common.Log.WriteDebug("%s: %s", setting.name, setting.flag)
+		}
+	}
+
+	if cxt.HTTP.TLS.Insecure {
+		common.Log.WriteDebug("Insecure: --insecure")
+	}
+}
+
+func (cxt *context) initTLSFlags(cloud *client.CloudConfig, cloudSource string) {
+	// cacert = --cacert -> clouds.yaml -> OS_CACERT
+	cxt.initTLSSetting("CACert", "--cacert", &cxt.HTTP.TLS.CACert, cloud.CACert, cloudSource, OpenStackCACertEnvVar)
+
+	// client-cert = --client-cert -> clouds.yaml -> OS_CERT
+	cxt.initTLSSetting("ClientCert", "--client-cert", &cxt.HTTP.TLS.ClientCert, cloud.Cert, cloudSource, OpenStackCertEnvVar)
+
+	// client-key = --client-key -> clouds.yaml -> OS_KEY
+	cxt.initTLSSetting("ClientKey", "--client-key", &cxt.HTTP.TLS.ClientKey, cloud.Key, cloudSource, OpenStackKeyEnvVar)
+
+	// insecure = --insecure -> clouds.yaml verify: false
+	if cxt.flagChanged("insecure") {
+		common.Log.WriteDebug("Insecure: --insecure")
+	} else if cloud.Verify != nil && !*cloud.Verify {
+		cxt.HTTP.TLS.Insecure = true
+		common.Log.WriteDebug("Insecure: %s", cloudSource)
+	}
+}
+
+// initTLSSetting reads a TLS setting from a flag, clouds.yaml or an environment variable
+func (cxt *context) initTLSSetting(name string, flag string, value *string, cloudValue string, cloudSource string, envVar string) {
+	if *value != "" {
+		common.Log.WriteDebug("%s: %s", name, flag)
+		return
+	}
+
+	cxt.initIdentitySetting(name, value, cloudValue, cloudSource, envVar)
+}
+
+// initIdentitySetting reads an identity v3 setting, which has no flag, from clouds.yaml or an environment variable
+func (cxt *context) initIdentitySetting(name string, value *string, cloudValue string, cloudSource string, envVar string) {
+	if *value != "" {
+		return
+	}
+
+	if cloudValue != "" {
+		*value = cloudValue
+		common.Log.WriteDebug("%s: %s", name, cloudSource)
+		return
+	}
+
+	*value = os.Getenv(envVar)
+	if *value != "" {
+		common.Log.WriteDebug("%s: %s", name, envVar)
+	}
+}
+
+// hasMagnumPasswordlessAuth checks if an application credential or pre-issued token is used instead of a username and password
+func (cxt *context) hasMagnumPasswordlessAuth() bool {
+	return cxt.ApplicationCredentialID != "" || cxt.Token != ""
+}
+
 func (cxt *context) loadCarinaProfile(profile map[string]string) (err error) {
 	cxt.AuthEndpoint, err = cxt.getProfileSetting(profile, "auth-endpoint", "", false)
 	if err != nil {
@@ -465,11 +906,30 @@ func (cxt *context) loadCarinaProfile(profile map[string]string) (err error) {
 		return err
 	}
 
-	return nil
+	err = cxt.loadTLSProfile(profile, &client.CloudConfig{})
+	if err != nil {
+		return err
+	}
+
+	return cxt.loadTimeoutsProfile(profile)
 }
 
 func (cxt *context) loadMagnumProfile(profile map[string]string) (err error) {
-	cxt.AuthEndpoint, err = cxt.getProfileSetting(profile, "auth-endpoint", "", true)
+	// Settings from clouds.yaml are the defaults for the profile
+	cxt.OSCloud, err = cxt.getProfileSetting(profile, "os-cloud", "", false)
+	if err != nil {
+		return err
+	}
+	cloud := &client.CloudConfig{}
+	if cxt.OSCloud != "" {
+		cloud, err = client.LoadCloudConfig(cxt.OSCloud)
+		if err != nil {
+			return fmt.Errorf("Invalid Profile: %s", err)
+		}
+		common.Log.WriteDebug("Reading cloud %s from %s", cxt.OSCloud, cloud.Source)
+	}
+
+	cxt.AuthEndpoint, err = cxt.getProfileSetting(profile, "auth-endpoint", cloud.Auth.AuthURL, true)
 	if err != nil {
 		return err
 	}
@@ -479,41 +939,209 @@ func (cxt *context) loadMagnumProfile(profile map[string]string) (err error) {
 		return err
 	}
 
-	cxt.Username, err = cxt.getProfileSetting(profile, "username", "", true)
+	identitySettings := []struct {
+		key          string
+		value        *string
+		defaultValue string
+	}{
+		{"user-id", &cxt.UserID, cloud.Auth.UserID},
+		{"project-id", &cxt.ProjectID, cloud.Auth.ProjectID},
+		{"user-domain", &cxt.UserDomain, cloud.Auth.UserDomainName},
+		{"user-domain-id", &cxt.UserDomainID, cloud.Auth.UserDomainID},
+		{"project-domain", &cxt.ProjectDomain, cloud.Auth.ProjectDomainName},
+		{"project-domain-id", &cxt.ProjectDomainID, cloud.Auth.ProjectDomainID},
+		{"application-credential-id", &cxt.ApplicationCredentialID, cloud.Auth.ApplicationCredentialID},
+		{"application-credential-secret", &cxt.ApplicationCredentialSecret, cloud.Auth.ApplicationCredentialSecret},
+		{"token", &cxt.Token, cloud.Auth.Token},
+	}
+	for _, setting := range identitySettings {
+		*setting.value, err = cxt.getProfileSetting(profile, setting.key, setting.defaultValue, false)
+		if err != nil {
+			return err
+		}
+	}
+	if cxt.ApplicationCredentialID != "" && cxt.ApplicationCredentialSecret == "" {
+		return fmt.Errorf("Invalid Profile: application-credential-secret is missing")
+	}
+
+	// A username and password are not required with an application credential or token
+	passwordless := cxt.hasMagnumPasswordlessAuth()
+
+	cxt.Username, err = cxt.getProfileSetting(profile, "username", cloud.Auth.Username, !passwordless && cxt.UserID == "")
 	if err != nil {
 		return err
 	}
 
-	cxt.Password, err = cxt.getProfileSetting(profile, "password", "", true)
+	cxt.Password, err = cxt.getProfileSetting(profile, "password", cloud.Auth.Password, !passwordless)
 	if err != nil {
 		return err
 	}
 
-	cxt.Project, err = cxt.getProfileSetting(profile, "project", "", true)
+	cxt.Project, err = cxt.getProfileSetting(profile, "project", cloud.Project(), !passwordless && cxt.ProjectID == "")
 	if err != nil {
 		return err
 	}
 
-	cxt.Domain, err = cxt.getProfileSetting(profile, "domain", "default", false)
+	cxt.Domain, err = cxt.getProfileSetting(profile, "domain", firstNonEmpty(cloud.Domain(), "default"), false)
 	if err != nil {
 		return err
 	}
 
-	cxt.Region, err = cxt.getProfileSetting(profile, "region", "RegionOne", false)
+	cxt.Region, err = cxt.getProfileSetting(profile, "region", firstNonEmpty(cloud.RegionName, "RegionOne"), false)
 	if err != nil {
 		return err
 	}
 
+	cxt.Interface, err = cxt.getProfileSetting(profile, "interface", cloud.Interface, false)
+	if err != nil {
+		return err
+	}
+
+	err = cxt.loadTLSProfile(profile, cloud)
+	if err != nil {
+		return err
+	}
+
+	err = cxt.loadTimeoutsProfile(profile)
+	if err != nil {
+		return err
+	}
+
+	// Flags take precedence over the credentials settings in the profile
+	if !cxt.flagChanged("csr") {
+		csr, err := cxt.getProfileSetting(profile, "csr", "", false)
+		if err != nil {
+			return err
+		}
+		if csr != "" {
+			cxt.CSR, err = strconv.ParseBool(csr)
+			if err != nil {
+				return fmt.Errorf("Invalid Profile: csr must be true or false")
+			}
+		}
+	}
+
+	if cxt.CSRKeyType == "" {
+		cxt.CSRKeyType, err = cxt.getProfileSetting(profile, "csr-key-type", "", false)
+		if err != nil {
+			return err
+		}
+	}
+
+	if cxt.CSRCommonName == "" {
+		cxt.CSRCommonName, err = cxt.getProfileSetting(profile, "csr-common-name", "", false)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// loadTLSProfile reads the TLS settings from a profile, flags take precedence over the profile
+func (cxt *context) loadTLSProfile(profile map[string]string, cloud *client.CloudConfig) (err error) {
+	tlsSettings := []struct {
+		key          string
+		value        *string
+		defaultValue string
+	}{
+		{"cacert", &cxt.HTTP.TLS.CACert, cloud.CACert},
+		{"client-cert", &cxt.HTTP.TLS.ClientCert, cloud.Cert},
+		{"client-key", &cxt.HTTP.TLS.ClientKey, cloud.Key},
+	}
+	for _, setting := range tlsSettings {
+		if *setting.value != "" {
+			continue
+		}
+		*setting.value, err = cxt.getProfileSetting(profile, setting.key, setting.defaultValue, false)
+		if err != nil {
+			return err
+		}
+	}
+
+	if !cxt.flagChanged("insecure") {
+		insecure, err := cxt.getProfileSetting(profile, "insecure", "", false)
+		if err != nil {
+			return err
+		}
+		if insecure != "" {
+			cxt.HTTP.TLS.Insecure, err = strconv.ParseBool(insecure)
+			if err != nil {
+				return fmt.Errorf("Invalid Profile: insecure must be true or false")
+			}
+		} else if cloud.Verify != nil {
+			cxt.HTTP.TLS.Insecure = !*cloud.Verify
+		}
+	}
+
+	return nil
+}
+
+// loadTimeoutsProfile reads the timeouts from a profile. The timeout setting applies to auth, API and credentials
+// requests, unless they have their own setting.
+func (cxt *context) loadTimeoutsProfile(profile map[string]string) error {
+	timeout, err := cxt.getProfileTimeout(profile, "timeout", 0)
+	if err != nil {
+		return err
+	}
+
+	timeoutSettings := []struct {
+		key          string
+		value        *time.Duration
+		defaultValue time.Duration
+	}{
+		{"connect-timeout", &cxt.HTTP.Timeouts.Connect, 0},
+		{"auth-timeout", &cxt.HTTP.Timeouts.Auth, timeout},
+		{"api-timeout", &cxt.HTTP.Timeouts.API, timeout},
+		{"credentials-timeout", &cxt.HTTP.Timeouts.Credentials, timeout},
+	}
+	for _, setting := range timeoutSettings {
+		*setting.value, err = cxt.getProfileTimeout(profile, setting.key, setting.defaultValue)
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
+func (cxt *context) getProfileTimeout(profile map[string]string, key string, defaultValue time.Duration) (time.Duration, error) {
+	value, err := cxt.getProfileSetting(profile, key, "", false)
+	if err != nil || value == "" {
+		return defaultValue, err
+	}
+
+	timeout, err := common.ParseTimeout(value)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid Profile: %s", err)
+	}
+	return timeout, nil
+}
+
 func (cxt *context) getProfileSetting(profile map[string]string, key string, defaultValue string, required bool) (string, error) {
 	envVar := profile[key+"-var"]
+	command := profile[key+"-cmd"]
+	file := profile[key+"-file"]
 	value := profile[key]
 
 	if envVar != "" {
 		value = os.Getenv(envVar)
 		common.Log.WriteSetting(key, envVar, value)
+	} else if command != "" {
+		// Never log the output, the command is typically a password manager
+		var err error
+		value, err = runSecretCommand(command)
+		if err != nil {
+			return "", fmt.Errorf("Invalid Profile: unable to read %s from %s-cmd. %s", key, key, err)
+		}
+		common.Log.WriteDebug("%s: %s-cmd (***)", key, key)
+	} else if file != "" {
+		var err error
+		value, err = readSecretFile(file)
+		if err != nil {
+			return "", fmt.Errorf("Invalid Profile: unable to read %s from %s-file. %s", key, key, err)
+		}
+		common.Log.WriteDebug("%s: %s (***)", key, file)
 	} else if value != "" {
 		common.Log.WriteSetting(key, "profile", value)
 	} else if defaultValue != "" {
@@ -525,5 +1153,28 @@ func (cxt *context) getProfileSetting(profile map[string]string, key string, def
 		return "", fmt.Errorf("Invalid Profile: %s is missing", key)
 	}
 
+	if common.IsEncryptedString(value) {
+		passphrase := os.Getenv(client.CarinaSecretsPassphraseEnvVar)
+		if passphrase == "" {
+			return "", fmt.Errorf("Invalid Profile: %s is encrypted, set %s to decrypt it", key, client.CarinaSecretsPassphraseEnvVar)
+		}
+
+		var err error
+		value, err = common.DecryptString(value, passphrase)
+		if err != nil {
+			return "", fmt.Errorf("Invalid Profile: unable to decrypt %s. %s", key, err)
+		}
+	}
+
 	return value, nil
 }
+
+// firstNonEmpty returns the first value which is not empty
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
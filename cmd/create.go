@@ -39,7 +39,6 @@ func newCreateCommand() *cobra.Command {
 		},
 	}
 
-	cmd.ValidArgs = []string{"cluster-name"}
 	cmd.Flags().StringVarP(&options.template, "template", "t", "", "Name of the template, defining the cluster topology and configuration")
 	cmd.Flags().IntVar(&options.nodes, "nodes", 1, "Number of nodes for the initial cluster")
 	cmd.Flags().BoolVar(&options.wait, "wait", false, "Wait for the cluster to become active")
@@ -13,12 +13,12 @@ func newCredentialsCommand() *cobra.Command {
 	}
 
 	var cmd = &cobra.Command{
-		Use:               "credentials <cluster-name>",
+		Use:               "credentials [<cluster-name>]",
 		Short:             "Download a cluster's credentials",
 		Long:              "Download a cluster's credentials",
 		PersistentPreRunE: authenticatedPreRunE,
 		PreRunE: func(cmd *cobra.Command, args []string) error {
-			return bindClusterNameArg(args, &options.name)
+			return bindActiveClusterNameArg(args, &options.name)
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
 			credentialsPath, err := cxt.Client.DownloadClusterCredentials(cxt.Account, options.name, options.path)
@@ -35,6 +35,12 @@ func newCredentialsCommand() *cobra.Command {
 		},
 	}
 
+	cmd.AddCommand(
+		newCredentialsExportCommand(),
+		newCredentialsImportCommand(),
+		newCredentialsRotateCommand(),
+	)
+
 	cmd.ValidArgs = []string{"cluster-name"}
 	cmd.Flags().StringVar(&options.path, "path", "", "Full path to the directory where the credentials should be saved")
 	cmd.SetUsageTemplate(cmd.UsageTemplate())
@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+
+	"github.com/getcarina/carina/common"
+	"github.com/getcarina/carina/console"
+	"github.com/spf13/cobra"
+)
+
+// CarinaPassphraseEnvVar is the passphrase used to encrypt and decrypt credentials archives
+const CarinaPassphraseEnvVar = "CARINA_PASSPHRASE"
+
+func newCredentialsExportCommand() *cobra.Command {
+	var options struct {
+		name       string
+		path       string
+		output     string
+		passphrase string
+	}
+
+	var cmd = &cobra.Command{
+		Use:   "export [<cluster-name>]",
+		Short: "Export a cluster's credentials to an archive",
+		Long:  "Export a cluster's credentials to a .tar.gz or .zip archive, which can be shared and then loaded with carina credentials import",
+		Example: `  carina credentials export mycluster -o mycluster.tar.gz
+  CARINA_PASSPHRASE=ilovepuppies carina credentials export mycluster -o mycluster.zip`,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if options.output == "" {
+				return errors.New("--output is required")
+			}
+
+			options.passphrase = bindPassphrase(options.passphrase)
+			return bindActiveClusterNameArg(args, &options.name)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			err := cxt.Client.ExportClusterCredentials(cxt.Account, options.name, options.path, options.output, options.passphrase)
+			if err != nil {
+				return err
+			}
+
+			console.Write("#")
+			console.Write("# Credentials exported to \"%s\"", options.output)
+			if options.passphrase == "" {
+				console.Write("# The archive is not encrypted, treat it like a password")
+			}
+			console.Write("#")
+
+			return nil
+		},
+	}
+
+	cmd.ValidArgs = []string{"cluster-name"}
+	cmd.Flags().StringVarP(&options.output, "output", "o", "", "Destination archive, ending in .tar.gz, .tgz or .zip")
+	cmd.Flags().StringVar(&options.passphrase, "passphrase", "", "Encrypt the archive with a passphrase [CARINA_PASSPHRASE]")
+	cmd.Flags().StringVar(&options.path, "path", "", "Full path to the directory from which the credentials should be loaded")
+	cmd.SetUsageTemplate(cmd.UsageTemplate())
+
+	return cmd
+}
+
+// bindPassphrase defaults an archive passphrase to the CARINA_PASSPHRASE environment variable
+func bindPassphrase(passphrase string) string {
+	if passphrase != "" {
+		common.Log.WriteDebug("Passphrase: --passphrase")
+		return passphrase
+	}
+
+	passphrase = os.Getenv(CarinaPassphraseEnvVar)
+	if passphrase != "" {
+		common.Log.WriteDebug("Passphrase: %s", CarinaPassphraseEnvVar)
+	}
+	return passphrase
+}
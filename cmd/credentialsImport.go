@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"errors"
+
+	"github.com/getcarina/carina/client"
+	"github.com/getcarina/carina/console"
+	"github.com/spf13/cobra"
+)
+
+func newCredentialsImportCommand() *cobra.Command {
+	var options struct {
+		archive    string
+		name       string
+		path       string
+		passphrase string
+	}
+
+	var cmd = &cobra.Command{
+		Use:   "import <archive>",
+		Short: "Import a cluster's credentials from an archive",
+		Long:  "Import a cluster's credentials from an archive created by carina credentials export, saving them where carina env expects to find them",
+		Example: `  carina credentials import mycluster.tar.gz --name mycluster
+  CARINA_PASSPHRASE=ilovepuppies carina credentials import mycluster.zip --name mycluster`,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) < 1 {
+				return errors.New("An archive is required")
+			}
+			options.archive = args[0]
+
+			if options.name == "" {
+				return errors.New("--name is required")
+			}
+
+			options.passphrase = bindPassphrase(options.passphrase)
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			credentialsPath, err := cxt.Client.ImportClusterCredentials(cxt.Account, options.name, options.archive, options.path, options.passphrase)
+			if err != nil {
+				return err
+			}
+
+			console.Write("#")
+			console.Write("# Credentials written to \"%s\"", credentialsPath)
+			console.Write(client.CredentialsNextStepsString(options.name))
+			console.Write("#")
+
+			return nil
+		},
+	}
+
+	cmd.ValidArgs = []string{"archive"}
+	cmd.Flags().StringVar(&options.name, "name", "", "Name of the cluster to which the credentials belong")
+	cmd.Flags().StringVar(&options.passphrase, "passphrase", "", "Passphrase used to encrypt the archive [CARINA_PASSPHRASE]")
+	cmd.Flags().StringVar(&options.path, "path", "", "Full path to the directory where the credentials should be saved")
+	cmd.SetUsageTemplate(cmd.UsageTemplate())
+
+	return cmd
+}
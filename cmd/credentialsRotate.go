@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"github.com/getcarina/carina/client"
+	"github.com/getcarina/carina/console"
+	"github.com/spf13/cobra"
+)
+
+func newCredentialsRotateCommand() *cobra.Command {
+	var options struct {
+		name string
+		path string
+	}
+
+	var cmd = &cobra.Command{
+		Use:   "rotate [<cluster-name>]",
+		Short: "Invalidate a cluster's credentials and download new ones",
+		Long:  "Invalidate all previously downloaded credentials for a cluster, then download a new credentials bundle. Any kubeconfig or docker context entries for the cluster are updated to use the new credentials. Anyone using the old credentials will need to download them again.",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return bindActiveClusterNameArg(args, &options.name)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			credentialsPath, updatedContexts, err := cxt.Client.RotateClusterCredentials(cxt.Account, options.name, options.path)
+			if err != nil {
+				return err
+			}
+
+			console.Write("#")
+			console.Write("# Credentials rotated and written to \"%s\"", credentialsPath)
+			for _, context := range updatedContexts {
+				console.Write("# Updated the %s", context)
+			}
+			console.Write(client.CredentialsNextStepsString(options.name))
+			console.Write("#")
+
+			return nil
+		},
+	}
+
+	cmd.ValidArgs = []string{"cluster-name"}
+	cmd.Flags().StringVar(&options.path, "path", "", "Full path to the directory where the credentials should be saved")
+	cmd.SetUsageTemplate(cmd.UsageTemplate())
+
+	return cmd
+}
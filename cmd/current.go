@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"errors"
+
+	"github.com/getcarina/carina/console"
+	"github.com/spf13/cobra"
+)
+
+func newCurrentCommand() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:               "current",
+		Short:             "Show the cluster selected with carina use",
+		Long:              "Show the cluster selected with carina use for the current account",
+		PersistentPreRunE: authenticatedPreRunE,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			active, ok := cxt.Client.Cache.GetActiveCluster(cxt.Account)
+			if !ok {
+				return errors.New("No cluster selected. Run carina use <cluster-name> to select one")
+			}
+
+			items := []console.Tuple{
+				{Key: "Cluster", Value: active.Name},
+				{Key: "Profile", Value: active.Profile},
+				{Key: "Cloud", Value: cxt.CloudType},
+			}
+			console.WriteMap(items)
+
+			return nil
+		},
+	}
+
+	cmd.SetUsageTemplate(cmd.UsageTemplate())
+
+	return cmd
+}
@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/getcarina/carina/common"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// defaultsSection is the config section, and profile subsection, which holds default values for command flags
+const defaultsSection = "defaults"
+
+// flagDefault is a default value for a command flag, labeled with the config section where it was set
+type flagDefault struct {
+	Flag    string
+	Value   string
+	Section string
+}
+
+// findFlagDefaults returns the configured default value of each flag of a command, sorted by flag name.
+// The profile's defaults take precedence over the [defaults] section, and within each,
+// defaults for the command, e.g. [defaults.create], take precedence over defaults for every command.
+func findFlagDefaults(cmd *cobra.Command, profile string) []flagDefault {
+	commandPath := strings.Replace(strings.TrimPrefix(cmd.CommandPath(), cmd.Root().Name()+" "), " ", ".", -1)
+
+	var sections []string
+	if profile != "" {
+		sections = append(sections, profile+"."+defaultsSection+"."+commandPath, profile+"."+defaultsSection)
+	}
+	sections = append(sections, defaultsSection+"."+commandPath, defaultsSection)
+
+	found := make(map[string]flagDefault)
+	for _, section := range sections {
+		if !viper.IsSet(section) {
+			continue
+		}
+
+		for name, value := range viper.GetStringMap(section) {
+			if _, exists := found[name]; exists || isConfigTable(value) || !isCommandFlag(cmd, name) {
+				continue
+			}
+			found[name] = flagDefault{Flag: name, Value: formatFlagDefault(value), Section: section}
+		}
+	}
+
+	var names []string
+	for name := range found {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	defaults := make([]flagDefault, len(names))
+	for i, name := range names {
+		defaults[i] = found[name]
+	}
+	return defaults
+}
+
+// applyFlagDefaults sets the configured defaults of the command's flags, skipping flags which were explicitly specified
+func applyFlagDefaults(cmd *cobra.Command, profile string) error {
+	for _, value := range findFlagDefaults(cmd, profile) {
+		if cmd.Flags().Changed(value.Flag) {
+			common.Log.WriteDebug("%s: --%s", value.Flag, value.Flag)
+			continue
+		}
+
+		// Set the value directly, so that the flag is not reported as changed by the user
+		err := cmd.Flags().Lookup(value.Flag).Value.Set(value.Value)
+		if err != nil {
+			return errors.Wrapf(err, "Invalid default for --%s in [%s]", value.Flag, value.Section)
+		}
+		common.Log.WriteDebug("%s: [%s] (%s)", value.Flag, value.Section, value.Value)
+	}
+
+	return nil
+}
+
+// isCommandFlag checks that a flag belongs to the command. Global flags are skipped, as they are resolved with the profile.
+func isCommandFlag(cmd *cobra.Command, name string) bool {
+	return cmd.Flags().Lookup(name) != nil && cmd.InheritedFlags().Lookup(name) == nil && cmd.PersistentFlags().Lookup(name) == nil
+}
+
+func isConfigTable(value interface{}) bool {
+	switch value.(type) {
+	case map[string]interface{}, map[interface{}]interface{}:
+		return true
+	}
+	return false
+}
+
+// formatFlagDefault converts a config value to the string form accepted by a flag, e.g. ["DFW", "IAD"] becomes DFW,IAD
+func formatFlagDefault(value interface{}) string {
+	if items, ok := value.([]interface{}); ok {
+		values := make([]string, len(items))
+		for i, item := range items {
+			values[i] = fmt.Sprint(item)
+		}
+		return strings.Join(values, ",")
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,380 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/getcarina/carina/client"
+	"github.com/getcarina/carina/common"
+	"github.com/getcarina/carina/console"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// credentialsExpiryWarning is how long before a cluster certificate expires that doctor warns about it
+const credentialsExpiryWarning = 30 * 24 * time.Hour
+
+// doctorCheck is the result of a single diagnostic check, with a suggested fix when it found a problem
+type doctorCheck struct {
+	status string
+	name   string
+	detail string
+	fix    string
+}
+
+const (
+	doctorOK      = "ok"
+	doctorWarning = "warn"
+	doctorFailed  = "fail"
+)
+
+// doctorReport collects the checks, and prints them as they complete
+type doctorReport struct {
+	problems int
+	warnings int
+}
+
+func (report *doctorReport) add(check doctorCheck) {
+	switch check.status {
+	case doctorFailed:
+		report.problems++
+	case doctorWarning:
+		report.warnings++
+	}
+
+	console.Write("[%s] %s: %s", check.status, check.name, check.detail)
+	if check.fix != "" {
+		console.Write("       Fix: %s", check.fix)
+	}
+}
+
+func newDoctorCommand() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "doctor",
+		Short: "Diagnose problems with the carina configuration",
+		Long: `Diagnose problems with the carina configuration.
+
+Explains how each setting was resolved, from a flag, environment variable, profile or default value. Then checks that the config file and cache can be read and written, that authentication works, and that the downloaded cluster credentials are valid. A fix is suggested for each problem found.`,
+		Example: `  carina doctor
+  carina doctor --profile dev`,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			// Skip authentication, doctor reports when it fails
+			cxt.initializeLogging()
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			report := &doctorReport{}
+
+			console.Write("Settings")
+			var initErr error
+			settings := captureDebugLog(func() {
+				initErr = cxt.initialize()
+			})
+			for _, line := range strings.Split(strings.TrimSpace(string(settings)), "\n") {
+				console.Write("  %s", strings.TrimPrefix(line, "debug: "))
+			}
+			if cxt.Client == nil {
+				cxt.Client = client.NewClient(cxt.CacheEnabled)
+			}
+
+			if defaults := describeFlagDefaults(cmd.Root(), cxt.Profile); len(defaults) > 0 {
+				console.Write("")
+				console.Write("Command Defaults")
+				for _, line := range defaults {
+					console.Write("  %s", line)
+				}
+			}
+
+			console.Write("")
+			console.Write("Checks")
+			checkEnvironment(report, cmd.Flags().Changed("cloud"))
+			checkConfigFile(report)
+			checkCache(report, cxt.Client.Cache)
+			checkAliases(report)
+
+			if initErr != nil {
+				report.add(doctorCheck{doctorFailed, "Credentials", initErr.Error(),
+					"Specify credentials with flags or environment variables, or create a profile with carina profile import. See carina --help"})
+			} else if clusters, ok := checkAuthentication(report); ok {
+				checkClusterCredentials(report, clusters)
+			}
+
+			if report.problems > 0 {
+				return fmt.Errorf("Found %d problem(s)", report.problems)
+			}
+			console.Write("")
+			if report.warnings > 0 {
+				console.Write("No problems found, %d warning(s)", report.warnings)
+			} else {
+				console.Write("No problems found")
+			}
+			return nil
+		},
+	}
+
+	cmd.SetUsageTemplate(cmd.UsageTemplate())
+
+	return cmd
+}
+
+// describeFlagDefaults lists the configured default of each command flag, and the config section where it was set
+func describeFlagDefaults(cmd *cobra.Command, profile string) []string {
+	var lines []string
+	for _, value := range findFlagDefaults(cmd, profile) {
+		lines = append(lines, fmt.Sprintf("%s --%s: [%s] (%s)", strings.TrimPrefix(cmd.CommandPath(), cmd.Root().Name()+" "), value.Flag, value.Section, value.Value))
+	}
+	for _, child := range cmd.Commands() {
+		// Aliases share the flags of the command they expand to, and are not given defaults of their own
+		if isAliasCommand(child) {
+			continue
+		}
+		lines = append(lines, describeFlagDefaults(child, profile)...)
+	}
+	return lines
+}
+
+// checkEnvironment looks for environment variables which override each other, or make the detected cloud ambiguous
+func checkEnvironment(report *doctorReport, cloudSpecified bool) {
+	conflicts := false
+	overrides := [][2]string{
+		{CarinaUserNameEnvVar, RackspaceUserNameEnvVar},
+		{CarinaAPIKeyEnvVar, RackspaceAPIKeyEnvVar},
+		{CarinaRegionEnvVar, RackspaceRegionEnvVar},
+	}
+	for _, pair := range overrides {
+		preferred, ignored := os.Getenv(pair[0]), os.Getenv(pair[1])
+		if preferred != "" && ignored != "" && preferred != ignored {
+			report.add(doctorCheck{doctorWarning, "Environment", fmt.Sprintf("%s and %s have different values, %s is used", pair[0], pair[1], pair[0]),
+				fmt.Sprintf("Unset %s", pair[1])})
+			conflicts = true
+		}
+	}
+
+	publicFound := os.Getenv(CarinaAPIKeyEnvVar) != "" || os.Getenv(RackspaceAPIKeyEnvVar) != ""
+	privateFound := os.Getenv(OpenStackPasswordEnvVar) != "" || os.Getenv(OpenStackApplicationCredentialIDEnvVar) != "" ||
+		os.Getenv(OpenStackTokenEnvVar) != "" || os.Getenv(OpenStackCloudEnvVar) != ""
+	if publicFound && privateFound && !cloudSpecified && cxt.Profile == "" {
+		report.add(doctorCheck{doctorWarning, "Environment", fmt.Sprintf("Both public and private cloud credentials are set, the %s cloud was selected", cxt.CloudType),
+			"Select the cloud with --cloud public or --cloud private, use a profile, or unset the credentials for the other cloud"})
+		conflicts = true
+	}
+
+	if conflicts {
+		return
+	}
+	report.add(doctorCheck{doctorOK, "Environment", "No conflicting environment variables", ""})
+}
+
+// checkConfigFile verifies that the config file is found, and only readable by the current user
+func checkConfigFile(report *doctorReport) {
+	configFile := viper.ConfigFileUsed()
+	if configFile == "" {
+		dirs, err := client.GetConfigDirs()
+		if err != nil {
+			report.add(doctorCheck{doctorFailed, "Config", err.Error(), fmt.Sprintf("Set %s to the config file", client.CarinaConfigEnvVar)})
+			return
+		}
+		report.add(doctorCheck{doctorOK, "Config", fmt.Sprintf("No config file found in %s, profiles are not available", strings.Join(dirs, ", ")), ""})
+		return
+	}
+
+	info, err := os.Stat(configFile)
+	if err != nil {
+		report.add(doctorCheck{doctorFailed, "Config", err.Error(), fmt.Sprintf("Check that %s exists and is readable", configFile)})
+		return
+	}
+
+	problems := false
+	if shadowed := findShadowedConfigFiles(configFile); len(shadowed) > 0 {
+		report.add(doctorCheck{doctorWarning, "Config", fmt.Sprintf("%s is used, other config files are ignored: %s", configFile, strings.Join(shadowed, ", ")),
+			fmt.Sprintf("Move any profiles into %s, then remove the other files", configFile)})
+		problems = true
+	}
+
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0077 != 0 {
+		report.add(doctorCheck{doctorWarning, "Config", fmt.Sprintf("%s is readable by other users (%s)", configFile, info.Mode().Perm()),
+			fmt.Sprintf("chmod 600 %s", configFile)})
+		problems = true
+	}
+
+	// Profiles are imported, and secrets encrypted, by rewriting the config file
+	if err := checkWritable(configFile); err != nil {
+		report.add(doctorCheck{doctorWarning, "Config", fmt.Sprintf("%s is not writable: %s", configFile, err),
+			fmt.Sprintf("Check the permissions of %s and its directory", configFile)})
+		problems = true
+	}
+
+	if problems {
+		return
+	}
+
+	report.add(doctorCheck{doctorOK, "Config", fmt.Sprintf("%s with %d profile(s)", configFile, len(listProfiles())), ""})
+}
+
+// checkWritable checks that a file can be atomically replaced, which requires writing to the file and its directory
+func checkWritable(path string) error {
+	file, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	file.Close()
+
+	temp, err := ioutil.TempFile(filepath.Dir(path), ".carina-doctor")
+	if err != nil {
+		return err
+	}
+	temp.Close()
+	return os.Remove(temp.Name())
+}
+
+// findShadowedConfigFiles returns the other config files in the config directories, which are ignored because configFile was found first.
+func findShadowedConfigFiles(configFile string) []string {
+	dirs, err := client.GetConfigDirs()
+	if err != nil {
+		return nil
+	}
+
+	var shadowed []string
+	for _, dir := range dirs {
+		for _, ext := range client.ConfigFileExtensions {
+			path := filepath.Join(dir, "config"+ext)
+			if path == configFile {
+				continue
+			}
+			if _, err := os.Stat(path); err == nil {
+				shadowed = append(shadowed, path)
+			}
+		}
+	}
+	return shadowed
+}
+
+// checkAliases reports the aliases in the config file which were skipped
+func checkAliases(report *doctorReport) {
+	if len(cxt.Aliases) == 0 && len(cxt.InvalidAliases) == 0 {
+		return
+	}
+
+	var names []string
+	for name := range cxt.InvalidAliases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		report.add(doctorCheck{doctorWarning, "Aliases", fmt.Sprintf("The %s alias was skipped, %s", name, cxt.InvalidAliases[name]),
+			fmt.Sprintf("Rename or fix the %s alias in the [aliases] section of %s", name, viper.ConfigFileUsed())})
+	}
+
+	if len(names) == 0 {
+		report.add(doctorCheck{doctorOK, "Aliases", fmt.Sprintf("%d alias(es) defined", len(cxt.Aliases)), ""})
+	}
+}
+
+// checkCache verifies that the cache was read, and that its directory is writable
+func checkCache(report *doctorReport, cache *client.Cache) {
+	path, err := client.GetCacheFilename()
+	if err != nil {
+		report.add(doctorCheck{doctorFailed, "Cache", err.Error(), fmt.Sprintf("Set %s to a writable directory", client.CarinaHomeDirEnvVar)})
+		return
+	}
+
+	if !cxt.CacheEnabled {
+		report.add(doctorCheck{doctorWarning, "Cache", "Disabled by --cache=false, every command authenticates again", "Remove --cache=false"})
+		return
+	}
+
+	if cache.Path() == "" {
+		report.add(doctorCheck{doctorFailed, "Cache", fmt.Sprintf("Unable to read %s", path), "Run carina cache clear, then check the permissions of the file"})
+		return
+	}
+
+	probe, err := ioutil.TempFile(filepath.Dir(path), ".doctor")
+	if err != nil {
+		report.add(doctorCheck{doctorFailed, "Cache", fmt.Sprintf("Unable to write to %s", filepath.Dir(path)),
+			fmt.Sprintf("Check the permissions of %s, or set %s to a writable directory", filepath.Dir(path), client.CarinaHomeDirEnvVar)})
+		return
+	}
+	probe.Close()
+	os.Remove(probe.Name())
+
+	report.add(doctorCheck{doctorOK, "Cache", path, ""})
+}
+
+// checkAuthentication verifies the credentials by listing the account's clusters
+func checkAuthentication(report *doctorReport) ([]common.Cluster, bool) {
+	clusters, err := cxt.Client.ListClusters(cxt.Account)
+	if err != nil {
+		report.add(doctorCheck{doctorFailed, "Authentication", err.Error(),
+			"Check the credentials, then run carina cache clear to discard the cached token. Run the command with --debug for details"})
+		return nil, false
+	}
+
+	report.add(doctorCheck{doctorOK, "Authentication", fmt.Sprintf("Authenticated as %s", cxt.Account.GetID()), ""})
+	return clusters, true
+}
+
+// checkClusterCredentials verifies each downloaded credentials bundle for the account, and finds bundles for deleted clusters
+func checkClusterCredentials(report *doctorReport, clusters []common.Cluster) {
+	existing := make(map[string]bool, len(clusters))
+	for _, cluster := range clusters {
+		existing[cluster.GetName()] = true
+	}
+
+	clustersDir, err := client.GetClusterCredentialsDir(cxt.Account)
+	if err != nil {
+		report.add(doctorCheck{doctorFailed, "Credentials", err.Error(), ""})
+		return
+	}
+
+	entries, err := ioutil.ReadDir(clustersDir)
+	if err != nil && !os.IsNotExist(err) {
+		report.add(doctorCheck{doctorFailed, "Credentials", err.Error(), fmt.Sprintf("Check the permissions of %s", clustersDir)})
+		return
+	}
+
+	var bundles int
+	problems := false
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		bundles++
+
+		name := entry.Name()
+		path := filepath.Join(clustersDir, name)
+		if !existing[name] {
+			report.add(doctorCheck{doctorWarning, "Credentials", fmt.Sprintf("%s: the cluster no longer exists", name), fmt.Sprintf("rm -r %s", path)})
+			problems = true
+			continue
+		}
+
+		expires, err := client.VerifyClusterCredentials(path)
+		switch {
+		case err != nil:
+			report.add(doctorCheck{doctorFailed, "Credentials", fmt.Sprintf("%s: %s", name, err), fmt.Sprintf("carina credentials %s", name)})
+			problems = true
+		case !expires.IsZero() && expires.Before(time.Now()):
+			report.add(doctorCheck{doctorFailed, "Credentials", fmt.Sprintf("%s: the certificate expired on %s", name, expires.Local().Format("2006-01-02")),
+				fmt.Sprintf("carina credentials %s", name)})
+			problems = true
+		case !expires.IsZero() && expires.Before(time.Now().Add(credentialsExpiryWarning)):
+			report.add(doctorCheck{doctorWarning, "Credentials", fmt.Sprintf("%s: the certificate expires on %s", name, expires.Local().Format("2006-01-02")),
+				fmt.Sprintf("carina credentials %s", name)})
+			problems = true
+		default:
+			common.Log.WriteDebug("Credentials for %s are valid", name)
+		}
+	}
+
+	if problems {
+		return
+	}
+
+	report.add(doctorCheck{doctorOK, "Credentials", fmt.Sprintf("Checked %d credentials bundle(s) in %s", bundles, clustersDir), ""})
+}
@@ -7,7 +7,9 @@ import (
 	"path/filepath"
 
 	"runtime"
+	"time"
 
+	"github.com/getcarina/carina/client"
 	"github.com/getcarina/carina/common"
 	"github.com/spf13/cobra"
 )
@@ -20,9 +22,9 @@ func newEnvCommand() *cobra.Command {
 	}
 
 	var cmd = &cobra.Command{
-		Use:               "env <cluster-name>",
+		Use:               "env [<cluster-name>]",
 		Short:             "Show the command to connect docker/kubectl to a cluster",
-		Long:              "Show the command to connect docker/kubectl to a cluster by setting environment variables in the current shell session",
+		Long:              "Show the command to connect docker/kubectl to a cluster by setting environment variables in the current shell session. CARINA_CLUSTER and CARINA_ENV_PROFILE are also set, so that carina prompt shows the loaded cluster and its profile.",
 		PersistentPreRunE: authenticatedPreRunE,
 		PreRunE: func(cmd *cobra.Command, args []string) error {
 			if options.shell == "" {
@@ -38,19 +40,37 @@ func newEnvCommand() *cobra.Command {
 						return errors.New("Shell was not specified. Either use --shell or set SHELL")
 					}
 				}
-			} else {
+			} else if cmd.Flags().Changed("shell") {
 				common.Log.WriteDebug("Shell: --shell (%s)", options.shell)
 			}
 
-			return bindClusterNameArg(args, &options.name)
+			return bindActiveClusterNameArg(args, &options.name)
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
-			sourceText, err := cxt.Client.GetSourceCommand(cxt.Account, options.shell, options.name, options.path)
+			// Remember what was loaded into this shell for carina prompt
+			variables := []client.ShellVariable{
+				{Name: client.CarinaClusterEnvVar, Value: options.name},
+				{Name: client.CarinaEnvProfileEnvVar, Value: cxt.Profile},
+			}
+			sourceText, err := cxt.Client.GetSourceCommand(cxt.Account, options.shell, options.name, options.path, variables)
 			if err != nil {
 				return err
 			}
 
 			fmt.Println(sourceText)
+
+			// Remember the cloud and region, which are not exported to the shell
+			err = cxt.Client.Cache.SaveLoadedCluster(client.LoadedCluster{
+				Profile:   cxt.Profile,
+				Cloud:     cxt.CloudType,
+				Region:    cxt.Region,
+				Cluster:   options.name,
+				Timestamp: time.Now(),
+			})
+			if err != nil {
+				common.Log.WriteDebug("Unable to cache the loaded cluster: %s", err)
+			}
+
 			return nil
 		},
 	}
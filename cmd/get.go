@@ -12,12 +12,12 @@ func newGetCommand() *cobra.Command {
 	}
 
 	var cmd = &cobra.Command{
-		Use:               "get <cluster-name>",
+		Use:               "get [<cluster-name>]",
 		Short:             "Show information about a cluster",
 		Long:              "Show information about a cluster",
 		PersistentPreRunE: authenticatedPreRunE,
 		PreRunE: func(cmd *cobra.Command, args []string) error {
-			return bindClusterNameArg(args, &options.name)
+			return bindActiveClusterNameArg(args, &options.name)
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
 			cluster, err := cxt.Client.GetCluster(cxt.Account, options.name, options.wait)
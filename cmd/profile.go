@@ -0,0 +1,26 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+func newProfileCommand() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "profile",
+		Short: "Manage the profiles in the config file",
+		Long:  "Manage the profiles in the config file. See carina --help for where it is found",
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			// Skip authentication and the release check, the profiles are not used
+			cxt.initializeLogging()
+			return nil
+		},
+	}
+
+	cmd.AddCommand(
+		newProfileImportCommand(),
+	)
+
+	cmd.SetUsageTemplate(cmd.UsageTemplate())
+
+	return cmd
+}
@@ -0,0 +1,280 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/getcarina/carina/client"
+	"github.com/getcarina/carina/common"
+	"github.com/getcarina/carina/console"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// importedSetting is a profile setting and the environment variables which hold its value, in order of precedence
+type importedSetting struct {
+	key     string
+	envVars []string
+	secret  bool
+}
+
+var privateImportedSettings = []importedSetting{
+	{key: "auth-endpoint", envVars: []string{OpenStackAuthURLEnvVar}},
+	{key: "endpoint", envVars: []string{OpenStackEndpointEnvVar}},
+	{key: "username", envVars: []string{OpenStackUserNameEnvVar}},
+	{key: "password", envVars: []string{OpenStackPasswordEnvVar}, secret: true},
+	{key: "project", envVars: []string{OpenStackProjectEnvVar, OpenStackTenantEnvVar}},
+	{key: "domain", envVars: []string{OpenStackProjectDomainEnvVar, OpenStackUserDomainEnvVar, OpenStackDomainEnvVar}},
+	{key: "region", envVars: []string{OpenStackRegionEnvVar}},
+	{key: "interface", envVars: []string{OpenStackInterfaceEnvVar}},
+	{key: "cacert", envVars: []string{OpenStackCACertEnvVar}},
+	{key: "client-cert", envVars: []string{OpenStackCertEnvVar}},
+	{key: "client-key", envVars: []string{OpenStackKeyEnvVar}},
+	{key: "user-id", envVars: []string{OpenStackUserIDEnvVar}},
+	{key: "project-id", envVars: []string{OpenStackProjectIDEnvVar}},
+	{key: "user-domain", envVars: []string{OpenStackUserDomainEnvVar}},
+	{key: "user-domain-id", envVars: []string{OpenStackUserDomainIDEnvVar}},
+	{key: "project-domain", envVars: []string{OpenStackProjectDomainEnvVar}},
+	{key: "project-domain-id", envVars: []string{OpenStackProjectDomainIDEnvVar}},
+	{key: "application-credential-id", envVars: []string{OpenStackApplicationCredentialIDEnvVar}},
+	{key: "application-credential-secret", envVars: []string{OpenStackApplicationCredentialSecretEnvVar}, secret: true},
+}
+
+var publicImportedSettings = []importedSetting{
+	{key: "auth-endpoint", envVars: []string{RackspaceAuthURLEnvVar}},
+	{key: "endpoint", envVars: []string{CarinaEndpointEnvVar}},
+	{key: "username", envVars: []string{CarinaUserNameEnvVar, RackspaceUserNameEnvVar}},
+	{key: "apikey", envVars: []string{CarinaAPIKeyEnvVar, RackspaceAPIKeyEnvVar}, secret: true},
+	{key: "region", envVars: []string{CarinaRegionEnvVar, RackspaceRegionEnvVar}},
+}
+
+var profileNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+func newProfileImportCommand() *cobra.Command {
+	var options struct {
+		name      string
+		secretVar string
+		secretCmd string
+	}
+
+	var cmd = &cobra.Command{
+		Use:   "import <env-file>",
+		Short: "Import a profile from an openrc or environment file",
+		Long: `Import a profile from the export statements of an OpenStack openrc file, such as one downloaded from Horizon, or a file which exports the Rackspace Public Cloud RS_* or CARINA_* environment variables.
+
+The file is read, not run. When the file prompts for the password, the profile reads it from the environment variable instead, e.g. password-var="OS_PASSWORD". Use --secret-var or --secret-cmd to read the password, apikey or application credential secret from somewhere else, such as a password manager.
+
+A password or apikey stored in the file is copied to the profile, encrypted when ` + client.CarinaSecretsPassphraseEnvVar + ` is set.`,
+		Example: `  carina profile import admin-openrc.sh --name dev
+  carina profile import admin-openrc.sh --name dev --secret-cmd "pass show openstack/dev"
+  carina profile import ~/rackspace.env --name public`,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return errors.New("An env file is required")
+			}
+			if options.name == "" {
+				return errors.New("--name is required")
+			}
+			if !profileNamePattern.MatchString(options.name) {
+				return fmt.Errorf("Invalid profile name %s, use only letters, numbers, - and _", options.name)
+			}
+			if options.secretVar != "" && options.secretCmd != "" {
+				return errors.New("Use either --secret-var or --secret-cmd, not both")
+			}
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			contents, err := ioutil.ReadFile(args[0])
+			if err != nil {
+				return errors.Wrapf(err, "Unable to read %s", args[0])
+			}
+
+			envFile, err := client.ParseEnvFile(contents)
+			if err != nil {
+				return errors.Wrapf(err, "Unable to read %s", args[0])
+			}
+
+			var cloud string
+			var settings []importedSetting
+			switch {
+			case envFile.Has(OpenStackAuthURLEnvVar):
+				cloud, settings = client.CloudMagnum, privateImportedSettings
+			case envFile.Has(CarinaAPIKeyEnvVar, RackspaceAPIKeyEnvVar, CarinaUserNameEnvVar, RackspaceUserNameEnvVar):
+				cloud, settings = client.CloudMakeCOE, publicImportedSettings
+			default:
+				return fmt.Errorf("No OS_*, RS_* or CARINA_* environment variables are exported by %s", args[0])
+			}
+			common.Log.WriteDebug("Cloud: %s", cloud)
+
+			configFile, err := getWritableConfigFile()
+			if err != nil {
+				return err
+			}
+			exists, err := profileExists(configFile, options.name)
+			if err != nil {
+				return err
+			}
+			if exists {
+				return fmt.Errorf("The %s profile already exists in %s", options.name, configFile)
+			}
+
+			// --secret-var and --secret-cmd replace a single secret, so that the command isn't run for each one
+			secretKey := importedSecretKey(envFile, settings)
+
+			profile := [][2]string{{"cloud", cloud}}
+			for _, setting := range settings {
+				if setting.key == secretKey && (options.secretVar != "" || options.secretCmd != "") {
+					if options.secretVar != "" {
+						profile = append(profile, [2]string{setting.key + "-var", options.secretVar})
+					} else {
+						profile = append(profile, [2]string{setting.key + "-cmd", options.secretCmd})
+					}
+					continue
+				}
+
+				key, value, err := importSetting(envFile, setting)
+				if err != nil {
+					return err
+				}
+				if key != "" {
+					profile = append(profile, [2]string{key, value})
+				}
+			}
+
+			err = appendProfile(configFile, options.name, profile)
+			if err != nil {
+				return err
+			}
+
+			console.Write("Imported the %s profile into %s", options.name, configFile)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&options.name, "name", "", "The name of the new profile")
+	cmd.Flags().StringVar(&options.secretVar, "secret-var", "", "Read the password or apikey from this environment variable")
+	cmd.Flags().StringVar(&options.secretCmd, "secret-cmd", "", "Read the password or apikey from the output of this command")
+	cmd.SetUsageTemplate(cmd.UsageTemplate())
+
+	return cmd
+}
+
+// importedSecretKey returns the secret setting replaced by --secret-var and --secret-cmd: the secret which the env file exports or prompts for,
+// preferring the application credential secret over the password, otherwise the password or apikey
+func importedSecretKey(envFile *client.EnvFile, settings []importedSetting) string {
+	var key string
+	for _, setting := range settings {
+		if !setting.secret {
+			continue
+		}
+		if key == "" || envFile.Has(setting.envVars...) {
+			key = setting.key
+		}
+	}
+	return key
+}
+
+// importSetting converts the first environment variable exported for a setting into the profile setting and its value
+func importSetting(envFile *client.EnvFile, setting importedSetting) (key string, value string, err error) {
+	for _, envVar := range setting.envVars {
+		switch {
+		case envFile.Values[envVar] != "":
+			value = envFile.Values[envVar]
+			if !setting.secret {
+				return setting.key, value, nil
+			}
+
+			passphrase := os.Getenv(client.CarinaSecretsPassphraseEnvVar)
+			if passphrase == "" {
+				common.Log.WriteWarning("The %s is stored in plaintext. Run carina config encrypt to encrypt it.", setting.key)
+				return setting.key, value, nil
+			}
+			value, err = common.EncryptString(value, passphrase)
+			return setting.key, value, err
+		case envFile.Prompted[envVar]:
+			// Read the value from the variable that the script would have exported
+			common.Log.WriteDebug("%s is read from a prompt, importing it as %s-var", envVar, setting.key)
+			return setting.key + "-var", envVar, nil
+		case envFile.References[envVar] != "":
+			return setting.key + "-var", envFile.References[envVar], nil
+		}
+	}
+
+	return "", "", nil
+}
+
+// getWritableConfigFile returns the config file to which profiles are added
+func getWritableConfigFile() (string, error) {
+	configFile := viper.ConfigFileUsed()
+	if configFile == "" {
+		configDir, err := client.GetConfigDir()
+		if err != nil {
+			return "", err
+		}
+		configFile = filepath.Join(configDir, "config.toml")
+	}
+
+	if strings.ToLower(filepath.Ext(configFile)) != ".toml" {
+		return "", fmt.Errorf("Unable to add a profile to %s, only TOML config files are supported", configFile)
+	}
+	return configFile, nil
+}
+
+// profileExists checks if a TOML config file has a section for the profile
+func profileExists(configFile string, name string) (bool, error) {
+	contents, err := ioutil.ReadFile(configFile)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.Wrapf(err, "Unable to read the config file %s", configFile)
+	}
+
+	header := regexp.MustCompile(`(?mi)^\s*\[\s*"?` + regexp.QuoteMeta(name) + `"?\s*\]`)
+	return header.Match(contents), nil
+}
+
+// appendProfile adds a profile to the end of a TOML config file, keeping the rest of the file as-is
+func appendProfile(configFile string, name string, profile [][2]string) error {
+	contents, err := ioutil.ReadFile(configFile)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "Unable to read the config file %s", configFile)
+	}
+
+	var section bytes.Buffer
+	if len(contents) > 0 {
+		if !bytes.HasSuffix(contents, []byte("\n")) {
+			section.WriteString("\n")
+		}
+		section.WriteString("\n")
+	}
+	fmt.Fprintf(&section, "[%s]\n", name)
+	for _, setting := range profile {
+		fmt.Fprintf(&section, "%s=%s\n", setting[0], strconv.Quote(setting[1]))
+	}
+
+	err = os.MkdirAll(filepath.Dir(configFile), 0700)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to create the directory for %s", configFile)
+	}
+
+	file, err := os.OpenFile(configFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to open the config file %s", configFile)
+	}
+	defer file.Close()
+
+	_, err = file.Write(section.Bytes())
+	if err != nil {
+		return errors.Wrapf(err, "Unable to write the config file %s", configFile)
+	}
+
+	return nil
+}
@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/getcarina/carina/client"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImportedSecretKey(t *testing.T) {
+	testcases := []struct {
+		name     string
+		envFile  string
+		settings []importedSetting
+		expected string
+	}{
+		{
+			name:     "password",
+			envFile:  "export OS_AUTH_URL=https://example.com/v3\nexport OS_PASSWORD=secret\n",
+			settings: privateImportedSettings,
+			expected: "password",
+		},
+		{
+			name:     "application credential",
+			envFile:  "export OS_AUTH_URL=https://example.com/v3\nexport OS_APPLICATION_CREDENTIAL_ID=abc\nexport OS_APPLICATION_CREDENTIAL_SECRET=secret\n",
+			settings: privateImportedSettings,
+			expected: "application-credential-secret",
+		},
+		{
+			name:     "application credential id without its secret",
+			envFile:  "export OS_AUTH_URL=https://example.com/v3\nexport OS_APPLICATION_CREDENTIAL_ID=abc\nexport OS_PASSWORD=secret\n",
+			settings: privateImportedSettings,
+			expected: "password",
+		},
+		{
+			name:     "no secret",
+			envFile:  "export OS_AUTH_URL=https://example.com/v3\nexport OS_USERNAME=alice\n",
+			settings: privateImportedSettings,
+			expected: "password",
+		},
+		{
+			name:     "apikey",
+			envFile:  "export CARINA_USERNAME=alice\n",
+			settings: publicImportedSettings,
+			expected: "apikey",
+		},
+	}
+
+	for _, tc := range testcases {
+		envFile, err := client.ParseEnvFile([]byte(tc.envFile))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, tc.expected, importedSecretKey(envFile, tc.settings), tc.name)
+	}
+}
@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// profileSecretTimeout is how long a profile's <key>-cmd or <key>-file has to produce a value
+var profileSecretTimeout = 30 * time.Second
+
+// runSecretCommand runs a <key>-cmd profile setting with the user's shell, returning its trimmed stdout
+func runSecretCommand(command string) (string, error) {
+	var c *exec.Cmd
+	if runtime.GOOS == "windows" {
+		c = exec.Command("cmd", "/C", command)
+	} else {
+		c = exec.Command("sh", "-c", command)
+	}
+
+	// Let the command prompt, e.g. for a gpg passphrase, and keep what it printed to stderr in case it fails
+	var stdout, stderr bytes.Buffer
+	c.Stdin = os.Stdin
+	c.Stdout = &stdout
+	c.Stderr = io.MultiWriter(os.Stderr, &stderr)
+
+	err := c.Start()
+	if err != nil {
+		return "", errors.Wrapf(err, "Unable to run '%s'", command)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Wait()
+	}()
+
+	select {
+	case err = <-done:
+	case <-time.After(profileSecretTimeout):
+		// Don't wait for the command to exit, a child process may still hold its output open
+		c.Process.Kill()
+		return "", fmt.Errorf("'%s' did not finish within %s", command, profileSecretTimeout)
+	}
+
+	if err != nil {
+		message := strings.TrimSpace(stderr.String())
+		if message == "" {
+			return "", fmt.Errorf("'%s' failed: %s", command, err)
+		}
+		return "", fmt.Errorf("'%s' failed: %s: %s", command, err, message)
+	}
+
+	value := strings.TrimSpace(stdout.String())
+	if value == "" {
+		return "", fmt.Errorf("'%s' did not print a value", command)
+	}
+
+	return value, nil
+}
+
+// readSecretFile reads a <key>-file profile setting, e.g. a mounted Docker or Kubernetes secret, returning its trimmed contents
+func readSecretFile(path string) (string, error) {
+	path = os.ExpandEnv(path)
+
+	type result struct {
+		contents []byte
+		err      error
+	}
+	done := make(chan result, 1)
+	go func() {
+		contents, err := ioutil.ReadFile(path)
+		done <- result{contents, err}
+	}()
+
+	var r result
+	select {
+	case r = <-done:
+	case <-time.After(profileSecretTimeout):
+		return "", fmt.Errorf("Unable to read %s within %s", path, profileSecretTimeout)
+	}
+
+	if r.err != nil {
+		return "", errors.Wrapf(r.err, "Unable to read %s", path)
+	}
+
+	value := strings.TrimSpace(string(r.contents))
+	if value == "" {
+		return "", fmt.Errorf("%s is empty", path)
+	}
+
+	return value, nil
+}
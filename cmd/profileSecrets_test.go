@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/getcarina/carina/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func skipOnWindows(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("The secret commands are written for sh")
+	}
+}
+
+func TestRunSecretCommand(t *testing.T) {
+	skipOnWindows(t)
+
+	value, err := runSecretCommand("printf '  s3cret\\n\\n'")
+	assert.NoError(t, err)
+	assert.Equal(t, "s3cret", value)
+}
+
+func TestRunSecretCommandFailure(t *testing.T) {
+	skipOnWindows(t)
+
+	_, err := runSecretCommand("echo 'vault is sealed' >&2; exit 3")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "exit status 3")
+		assert.Contains(t, err.Error(), "vault is sealed")
+	}
+}
+
+func TestRunSecretCommandTimeout(t *testing.T) {
+	skipOnWindows(t)
+
+	original := profileSecretTimeout
+	profileSecretTimeout = 100 * time.Millisecond
+	defer func() { profileSecretTimeout = original }()
+
+	start := time.Now()
+	_, err := runSecretCommand("sleep 5")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "did not finish within")
+	}
+	assert.True(t, time.Since(start) < 2*time.Second, "Expected the command to be abandoned at the timeout")
+}
+
+func TestRunSecretCommandWithoutOutput(t *testing.T) {
+	skipOnWindows(t)
+
+	_, err := runSecretCommand("echo")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "did not print a value")
+	}
+}
+
+func TestReadSecretFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "carina-secrets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "apikey")
+	err = ioutil.WriteFile(path, []byte("\n abc123 \r\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	value, err := readSecretFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "abc123", value)
+
+	_, err = readSecretFile(filepath.Join(dir, "missing"))
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "Unable to read")
+	}
+}
+
+func TestProfileSecretCommandIsNotLogged(t *testing.T) {
+	skipOnWindows(t)
+
+	var output bytes.Buffer
+	originalOut, originalLevel := common.Log.Out, common.Log.Level
+	common.Log.Out = &output
+	common.Log.Level = logrus.DebugLevel
+	defer func() {
+		common.Log.Out = originalOut
+		common.Log.Level = originalLevel
+	}()
+
+	value, err := (&context{}).getProfileSetting(map[string]string{"password-cmd": "echo s3cret"}, "password", "", true)
+	assert.NoError(t, err)
+	assert.Equal(t, "s3cret", value)
+
+	assert.Contains(t, output.String(), "password-cmd (***)")
+	assert.NotContains(t, output.String(), "s3cret")
+}
@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/template"
+
+	"github.com/getcarina/carina/client"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// CarinaPromptFormatEnvVar is the default format for carina prompt
+const CarinaPromptFormatEnvVar = "CARINA_PROMPT_FORMAT"
+
+const defaultPromptFormat = "({{.Cloud}}:{{.Region}} {{.Cluster}}) "
+
+var promptSnippets = map[string]string{
+	"bash": `# Add the following to ~/.bashrc
+PS1='$(carina prompt)'"$PS1"`,
+	"zsh": `# Add the following to ~/.zshrc
+setopt PROMPT_SUBST
+PROMPT='$(carina prompt)'"$PROMPT"`,
+	"fish": `# Add the following to ~/.config/fish/config.fish
+function fish_right_prompt
+    carina prompt
+end`,
+	"powershell": `# Add the following to your PowerShell profile, e.g. $PROFILE
+$__carinaOriginalPrompt = $function:prompt
+function prompt {
+    Write-Host -NoNewline (carina prompt)
+    & $__carinaOriginalPrompt
+}`,
+}
+
+func newPromptCommand() *cobra.Command {
+	var options struct {
+		format string
+		init   string
+	}
+
+	var cmd = &cobra.Command{
+		Use:   "prompt",
+		Short: "Show the cluster loaded with carina env, for use in a shell prompt",
+		Long: `Show the cluster loaded into the current shell with carina env, for use in a shell prompt.
+
+The cluster and profile are read from the CARINA_CLUSTER and CARINA_ENV_PROFILE environment variables set by carina env, so each shell shows its own cluster.
+Only the environment, config file and cache are read, so this is fast enough to run every time the prompt is drawn. Nothing is printed when no cluster has been loaded.
+
+The output is a Go template with the following fields: .Profile, .Cloud, .Region and .Cluster.
+Use --init to print a snippet which adds the prompt to bash, zsh, fish or powershell.`,
+		Example: `  carina prompt --format "{{.Profile}}/{{.Cluster}}"
+  carina prompt --init bash >> ~/.bashrc`,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			// Skip authentication and the release check, this must never hit the network
+			cxt.Client = client.NewClient(cxt.CacheEnabled)
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if options.init != "" {
+				snippet, ok := promptSnippets[options.init]
+				if !ok {
+					return fmt.Errorf("Invalid --init value: %s. Allowed values are bash, zsh, fish and powershell", options.init)
+				}
+				fmt.Println(snippet)
+				return nil
+			}
+
+			loaded := findShellLoadedCluster(cxt.Client.Cache)
+			if loaded == nil {
+				return nil
+			}
+
+			if options.format == "" {
+				options.format = os.Getenv(CarinaPromptFormatEnvVar)
+			}
+			if options.format == "" {
+				options.format = defaultPromptFormat
+			}
+
+			t, err := template.New("prompt").Parse(options.format)
+			if err != nil {
+				return errors.Wrap(err, "Invalid --format")
+			}
+
+			return t.Execute(os.Stdout, loaded)
+		},
+	}
+
+	cmd.Flags().StringVar(&options.format, "format", "", "Go template used to format the prompt [CARINA_PROMPT_FORMAT]")
+	cmd.Flags().StringVar(&options.init, "init", "", "Print a snippet which adds the prompt to a shell. Allowed values: bash, zsh, fish, powershell")
+	cmd.SetUsageTemplate(cmd.UsageTemplate())
+
+	return cmd
+}
+
+// findShellLoadedCluster returns the cluster loaded into the current shell with carina env, from CARINA_CLUSTER and CARINA_ENV_PROFILE.
+// The cloud and region are not exported to the shell, so they are looked up from the profile, or the cached cluster most recently loaded.
+func findShellLoadedCluster(cache *client.Cache) *client.LoadedCluster {
+	name := os.Getenv(client.CarinaClusterEnvVar)
+	if name == "" {
+		return nil
+	}
+	loaded := &client.LoadedCluster{Profile: os.Getenv(client.CarinaEnvProfileEnvVar), Cluster: name}
+
+	if recent := cache.LoadedCluster; recent != nil && recent.Profile == loaded.Profile && recent.Cluster == loaded.Cluster {
+		loaded.Cloud = recent.Cloud
+		loaded.Region = recent.Region
+		return loaded
+	}
+
+	if loaded.Profile != "" {
+		profile := viper.GetStringMapString(loaded.Profile)
+		loaded.Cloud = profile["cloud"]
+		loaded.Region = profile["region"]
+	}
+	return loaded
+}
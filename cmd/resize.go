@@ -15,7 +15,7 @@ func newResizeCommand() *cobra.Command {
 	}
 
 	var cmd = &cobra.Command{
-		Use:               "resize <cluster-name>",
+		Use:               "resize [<cluster-name>]",
 		Short:             "Resize a cluster",
 		Long:              "Resize a cluster by setting the number of cluster nodes",
 		PersistentPreRunE: authenticatedPreRunE,
@@ -24,7 +24,7 @@ func newResizeCommand() *cobra.Command {
 				return errors.New("--nodes must be >= 1")
 			}
 
-			return bindClusterNameArg(args, &options.name)
+			return bindActiveClusterNameArg(args, &options.name)
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
 			cluster, err := cxt.Client.ResizeCluster(cxt.Account, options.name, options.nodes, options.wait)
@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"errors"
+
+	"github.com/getcarina/carina/console"
+	"github.com/spf13/cobra"
+)
+
+func newUseCommand() *cobra.Command {
+	var options struct {
+		name  string
+		clear bool
+	}
+
+	var cmd = &cobra.Command{
+		Use:   "use <cluster-name>",
+		Short: "Select the cluster to use when a cluster name is omitted",
+		Long:  "Select the cluster to use when a cluster name is omitted from commands such as env, get, resize and credentials. The selection is saved separately for each account.",
+		Example: `  carina use mycluster
+  carina env
+  carina use --clear`,
+		PersistentPreRunE: authenticatedPreRunE,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if options.clear {
+				if len(args) > 0 {
+					return errors.New("A cluster name cannot be used with --clear")
+				}
+				return nil
+			}
+
+			return bindClusterNameArg(args, &options.name)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if options.clear {
+				err := cxt.Client.Cache.SaveActiveCluster(cxt.Account, "", "")
+				if err != nil {
+					return err
+				}
+
+				console.Write("Cleared the active cluster")
+				return nil
+			}
+
+			// Make sure the cluster exists before selecting it
+			cluster, err := cxt.Client.GetCluster(cxt.Account, options.name, false)
+			if err != nil {
+				return err
+			}
+
+			err = cxt.Client.Cache.SaveActiveCluster(cxt.Account, cxt.Profile, cluster.GetName())
+			if err != nil {
+				return err
+			}
+
+			console.Write("Using cluster %s", cluster.GetName())
+			return nil
+		},
+	}
+
+	cmd.ValidArgs = []string{"cluster-name"}
+	cmd.Flags().BoolVar(&options.clear, "clear", false, "Clear the active cluster")
+	cmd.SetUsageTemplate(cmd.UsageTemplate())
+
+	return cmd
+}
@@ -0,0 +1,275 @@
+package common
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Cassette is a set of recorded HTTP interactions, with secrets redacted
+type Cassette struct {
+	Interactions []*Interaction `json:"interactions"`
+
+	path     string
+	replay   bool
+	used     []bool
+	mutex    sync.Mutex
+	original http.RoundTripper
+}
+
+// base64Encoding marks a recorded body which is base64 encoded, because it isn't JSON, e.g. a zip of a cluster's credentials
+const base64Encoding = "base64"
+
+// Interaction is a recorded request and its response
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+// RecordedRequest is the request of an interaction
+type RecordedRequest struct {
+	Method   string      `json:"method"`
+	URL      string      `json:"url"`
+	Headers  http.Header `json:"headers"`
+	Body     string      `json:"body"`
+	Encoding string      `json:"encoding,omitempty"`
+}
+
+// RecordedResponse is the response of an interaction
+type RecordedResponse struct {
+	StatusCode int         `json:"status_code"`
+	Headers    http.Header `json:"headers"`
+	Body       string      `json:"body"`
+	Encoding   string      `json:"encoding,omitempty"`
+}
+
+// cassette is used by every client from NewHTTPClient, when recording or replaying
+var cassette *Cassette
+
+// StartRecording records every round trip to a cassette file, replacing its contents
+func StartRecording(path string) error {
+	if cassette != nil {
+		return nil
+	}
+
+	c := &Cassette{path: path}
+	err := c.save()
+	if err != nil {
+		return err
+	}
+
+	Log.WriteDebug("Recording HTTP interactions to %s", path)
+	useCassette(c)
+	return nil
+}
+
+// StartReplay serves responses from a cassette file, instead of making requests
+func StartReplay(path string) error {
+	if cassette != nil {
+		return nil
+	}
+
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to read the cassette %s", path)
+	}
+
+	c := &Cassette{path: path, replay: true}
+	err = json.Unmarshal(contents, c)
+	if err != nil {
+		return errors.Wrapf(err, "Invalid cassette %s", path)
+	}
+	c.used = make([]bool, len(c.Interactions))
+
+	Log.WriteDebug("Replaying %d HTTP interactions from %s", len(c.Interactions), path)
+	useCassette(c)
+	return nil
+}
+
+// useCassette activates the cassette, including for requests made with the default http client, such as when libcarina authenticates
+func useCassette(c *Cassette) {
+	cassette = c
+	c.original = http.DefaultTransport
+	http.DefaultTransport = c.transport(http.DefaultTransport)
+}
+
+// StopCassette stops recording or replaying, and restores the default http client
+func StopCassette() {
+	if cassette == nil {
+		return
+	}
+
+	http.DefaultTransport = cassette.original
+	cassette = nil
+}
+
+func (c *Cassette) transport(rt http.RoundTripper) http.RoundTripper {
+	return &cassetteTransport{cassette: c, rt: rt}
+}
+
+// cassetteTransport satisfies the http.RoundTripper interface and records or replays the round trips
+type cassetteTransport struct {
+	cassette *Cassette
+	rt       http.RoundTripper
+}
+
+// RoundTrip records a round-trip HTTP request, or replays its recorded response
+func (transport *cassetteTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	requestBody, err := readBody(request.Body)
+	if err != nil {
+		return nil, err
+	}
+	if request.Body != nil {
+		request.Body = ioutil.NopCloser(bytes.NewReader(requestBody))
+	}
+
+	if transport.cassette.replay {
+		return transport.cassette.play(request)
+	}
+
+	response, err := transport.rt.RoundTrip(request)
+	if err != nil {
+		return nil, err
+	}
+
+	responseBody, err := readBody(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	response.Body = ioutil.NopCloser(bytes.NewReader(responseBody))
+
+	interaction := &Interaction{
+		Request: RecordedRequest{
+			Method:  request.Method,
+			URL:     redactURL(request),
+			Headers: RedactHeaders(request.Header),
+		},
+		Response: RecordedResponse{
+			StatusCode: response.StatusCode,
+			Headers:    RedactHeaders(response.Header),
+		},
+	}
+	interaction.Request.Body, interaction.Request.Encoding, err = encodeBody(requestBody)
+	if err != nil {
+		return nil, err
+	}
+	interaction.Response.Body, interaction.Response.Encoding, err = encodeBody(responseBody)
+	if err != nil {
+		return nil, err
+	}
+
+	err = transport.cassette.record(interaction)
+	return response, err
+}
+
+// encodeBody redacts a body for the cassette. JSON is kept readable, other bodies are base64 encoded,
+// so that binary files such as the zip of a cluster's credentials are replayed byte for byte.
+func encodeBody(body []byte) (string, string, error) {
+	var data interface{}
+	if len(body) == 0 || json.Unmarshal(body, &data) == nil {
+		return string(RedactBody(body)), "", nil
+	}
+
+	body, err := redactArchive(body)
+	if err != nil {
+		return "", "", err
+	}
+	return base64.StdEncoding.EncodeToString(body), base64Encoding, nil
+}
+
+// decodeBody reverses encodeBody, when replaying a recorded body
+func decodeBody(body string, encoding string) ([]byte, error) {
+	switch encoding {
+	case "":
+		return []byte(body), nil
+	case base64Encoding:
+		return base64.StdEncoding.DecodeString(body)
+	default:
+		return nil, fmt.Errorf("Unsupported body encoding %s", encoding)
+	}
+}
+
+// record appends an interaction, saving the cassette immediately so that nothing is lost when the cli exits with an error
+func (c *Cassette) record(interaction *Interaction) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.Interactions = append(c.Interactions, interaction)
+	return c.save()
+}
+
+func (c *Cassette) save() error {
+	contents, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = ioutil.WriteFile(c.path, contents, 0600)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to write the cassette %s", c.path)
+	}
+	return nil
+}
+
+// play returns the next recorded response for the request's method and url. When they have all been used,
+// e.g. because the cli polled more often than when it was recorded, the last one is repeated.
+func (c *Cassette) play(request *http.Request) (*http.Response, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	url := redactURL(request)
+	match := -1
+	for i, interaction := range c.Interactions {
+		if interaction.Request.Method != request.Method || interaction.Request.URL != url {
+			continue
+		}
+
+		match = i
+		if !c.used[i] {
+			break
+		}
+	}
+	if match == -1 {
+		return nil, fmt.Errorf("No recorded response for %s %s in the cassette %s", request.Method, url, c.path)
+	}
+	c.used[match] = true
+
+	recorded := c.Interactions[match].Response
+	body, err := decodeBody(recorded.Body, recorded.Encoding)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Invalid response for %s %s in the cassette %s", request.Method, url, c.path)
+	}
+
+	headers := http.Header{}
+	for key, values := range recorded.Headers {
+		headers[key] = values
+	}
+	headers.Del("Content-Length")
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", recorded.StatusCode, http.StatusText(recorded.StatusCode)),
+		StatusCode:    recorded.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        headers,
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       request,
+	}, nil
+}
+
+func readBody(body io.ReadCloser) ([]byte, error) {
+	if body == nil {
+		return nil, nil
+	}
+	defer body.Close()
+	return ioutil.ReadAll(body)
+}
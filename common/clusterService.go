@@ -26,6 +26,9 @@ type ClusterService interface {
 	// GetClusterCredentials retrieves the TLS certificates and configuration scripts for a cluster by its id or name (if unique)
 	GetClusterCredentials(token string) (*libcarina.CredentialsBundle, error)
 
+	// RotateClusterCredentials invalidates all previously issued credentials for a cluster by its id or name (if unique)
+	RotateClusterCredentials(token string) error
+
 	// ResizeCluster resizes the cluster to the specified number of nodes
 	ResizeCluster(token string, nodes int) (Cluster, error)
 
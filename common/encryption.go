@@ -0,0 +1,138 @@
+package common
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/scrypt"
+)
+
+// encryptedHeader identifies data sealed by EncryptWithPassphrase
+var encryptedHeader = []byte("CARINA-ENC1\n")
+
+const saltSize = 16
+
+// IsEncrypted checks if the data was sealed by EncryptWithPassphrase
+func IsEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, encryptedHeader)
+}
+
+// EncryptWithPassphrase seals data with AES-256-GCM, using a key derived from the passphrase
+func EncryptWithPassphrase(plaintext []byte, passphrase string) ([]byte, error) {
+	salt := make([]byte, saltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, errors.Wrap(err, "Unable to generate a random salt")
+	}
+
+	gcm, err := newPassphraseCipher(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, errors.Wrap(err, "Unable to generate a random nonce")
+	}
+
+	// header | salt | nonce | ciphertext
+	var sealed bytes.Buffer
+	sealed.Write(encryptedHeader)
+	sealed.Write(salt)
+	sealed.Write(nonce)
+	sealed.Write(gcm.Seal(nil, nonce, plaintext, encryptedHeader))
+
+	return sealed.Bytes(), nil
+}
+
+// DecryptWithPassphrase opens data sealed by EncryptWithPassphrase
+func DecryptWithPassphrase(data []byte, passphrase string) ([]byte, error) {
+	if !IsEncrypted(data) {
+		return nil, errors.New("The data is not encrypted")
+	}
+	data = data[len(encryptedHeader):]
+
+	if len(data) < saltSize {
+		return nil, errors.New("The encrypted data is truncated")
+	}
+	salt := data[:saltSize]
+	data = data[saltSize:]
+
+	gcm, err := newPassphraseCipher(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.New("The encrypted data is truncated")
+	}
+	nonce := data[:gcm.NonceSize()]
+	data = data[gcm.NonceSize():]
+
+	plaintext, err := gcm.Open(nil, nonce, data, encryptedHeader)
+	if err != nil {
+		return nil, errors.New("Unable to decrypt, the passphrase is incorrect or the data is corrupt")
+	}
+
+	return plaintext, nil
+}
+
+func newPassphraseCipher(passphrase string, salt []byte) (cipher.AEAD, error) {
+	if passphrase == "" {
+		return nil, errors.New("A passphrase is required")
+	}
+
+	key, err := scrypt.Key([]byte(passphrase), salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, errors.Wrap(err, "Unable to derive an encryption key from the passphrase")
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "Unable to initialize the cipher")
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// encryptedValuePrefix identifies a text value sealed by EncryptString, e.g. in the config file or the cache
+const encryptedValuePrefix = "enc:"
+
+// IsEncryptedString checks if the value was sealed by EncryptString
+func IsEncryptedString(value string) bool {
+	return strings.HasPrefix(value, encryptedValuePrefix)
+}
+
+// EncryptString seals a value with EncryptWithPassphrase, encoded so that it can be stored as text
+func EncryptString(value string, passphrase string) (string, error) {
+	sealed, err := EncryptWithPassphrase([]byte(value), passphrase)
+	if err != nil {
+		return "", err
+	}
+
+	return encryptedValuePrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// DecryptString opens a value sealed by EncryptString
+func DecryptString(value string, passphrase string) (string, error) {
+	if !IsEncryptedString(value) {
+		return "", errors.New("The value is not encrypted")
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, encryptedValuePrefix))
+	if err != nil {
+		return "", errors.Wrap(err, "The encrypted value is corrupt")
+	}
+
+	plaintext, err := DecryptWithPassphrase(sealed, passphrase)
+	if err != nil {
+		return "", err
+	}
+
+	return string(plaintext), nil
+}
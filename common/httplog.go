@@ -2,6 +2,7 @@ package common
 
 import (
 	"bytes"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -26,21 +27,32 @@ type HTTPLog struct {
 // NewHTTPClient return a custom HTTP client that allows for logging relevant
 // information before and after the HTTP request.
 func NewHTTPClient() *http.Client {
-	timeout := 10 * time.Second
+	return newHTTPClient(nil, DefaultRetryPolicy, DefaultTimeouts.Connect, DefaultTimeouts.API)
+}
+
+// newHTTPClient builds our HTTP client, using the default TLS configuration when tlsConfig is nil.
+// Each attempt made by the retry policy is logged separately, and all attempts must complete within the timeout.
+func newHTTPClient(tlsConfig *tls.Config, policy RetryPolicy, connectTimeout time.Duration, timeout time.Duration) *http.Client {
+	var rt http.RoundTripper = &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		Dial: (&net.Dialer{
+			Timeout: connectTimeout,
+		}).Dial,
+		TLSClientConfig:       tlsConfig,
+		TLSHandshakeTimeout:   connectTimeout,
+		IdleConnTimeout:       30 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+	if cassette != nil {
+		rt = cassette.transport(rt)
+	}
+
 	return &http.Client{
 		Timeout: timeout,
-		Transport: &HTTPLog{
-			rt: &http.Transport{
-				Proxy:             http.ProxyFromEnvironment,
-				DisableKeepAlives: true, // KeepAlive was causing "connection reset by peer" errors when issuing multiple requests
-				Dial: (&net.Dialer{
-					Timeout: timeout,
-				}).Dial,
-				TLSHandshakeTimeout:   timeout,
-				ExpectContinueTimeout: 1 * time.Second,
-			},
+		Transport: NewRetryTransport(&HTTPLog{
+			rt:     rt,
 			Logger: Log.Logger,
-		},
+		}, policy.withTimeout(timeout)),
 	}
 }
 
@@ -64,13 +76,8 @@ func (hl *HTTPLog) RoundTrip(request *http.Request) (*http.Response, error) {
 		}
 	}
 
-	// Don't log the token embedded in a cached auth token check
-	url := request.URL.String()
-	if strings.Contains(url, "tokens") {
-		url = fmt.Sprintf("%s://%s/***", request.URL.Scheme, request.URL.Host)
-	}
-
-	hl.Logger.Debugf("Request: %s %s", request.Method, url)
+	hl.Logger.Debugf("Request: %s %s", request.Method, redactURL(request))
+	hl.Logger.Debugf("Request Headers: %v", RedactHeaders(request.Header))
 
 	response, err := hl.rt.RoundTrip(request)
 	if response == nil {
@@ -84,7 +91,7 @@ func (hl *HTTPLog) RoundTrip(request *http.Request) (*http.Response, error) {
 		hl.Logger.Debugf("Response Code: %d %s", response.StatusCode, response.Status)
 		buf := bytes.NewBuffer([]byte{})
 		body, _ := ioutil.ReadAll(io.TeeReader(response.Body, buf))
-		hl.Logger.Debugf("Response Error: %+v", string(body))
+		hl.Logger.Debugf("Response Error: %+v", string(RedactBody(body)))
 		bufWithClose := ioutil.NopCloser(buf)
 		response.Body = bufWithClose
 	}
@@ -92,6 +99,15 @@ func (hl *HTTPLog) RoundTrip(request *http.Request) (*http.Response, error) {
 	return response, err
 }
 
+// redactURL hides the token embedded in a cached auth token check
+func redactURL(request *http.Request) string {
+	url := request.URL.String()
+	if strings.Contains(url, "tokens") {
+		url = fmt.Sprintf("%s://%s/***", request.URL.Scheme, request.URL.Host)
+	}
+	return url
+}
+
 func (hl *HTTPLog) logRequestBody(original io.ReadCloser, headers http.Header) (io.ReadCloser, error) {
 	defer original.Close()
 
@@ -103,10 +119,10 @@ func (hl *HTTPLog) logRequestBody(original io.ReadCloser, headers http.Header) (
 
 	contentType := headers.Get("Content-Type")
 	if strings.HasPrefix(contentType, "application/json") {
-		debugInfo := hl.formatJSON(bs.Bytes())
+		debugInfo := hl.formatJSON(RedactBody(bs.Bytes()))
 		hl.Logger.Debugf("Request Options: %s", debugInfo)
 	} else {
-		hl.Logger.Debugf("Request Options: %s", bs.String())
+		hl.Logger.Debugf("Request Options: %s", RedactBody(bs.Bytes()))
 	}
 
 	return ioutil.NopCloser(strings.NewReader(bs.String())), nil
@@ -120,7 +136,7 @@ func (hl *HTTPLog) logResponseBody(original io.ReadCloser, headers http.Header)
 		if strings.Contains(strings.ToLower(key), "request-id") {
 			requestID := value[0]
 			hl.Logger.Debugf("Request ID: %s", requestID)
-			Log.ErrorContext["Request ID"] = requestID
+			Log.SetErrorContext("Request ID", requestID)
 			break
 		}
 	}
@@ -133,7 +149,7 @@ func (hl *HTTPLog) logResponseBody(original io.ReadCloser, headers http.Header)
 
 	contentType := headers.Get("Content-Type")
 	if strings.HasPrefix(contentType, "application/json") {
-		debugInfo := hl.formatJSON(bs.Bytes())
+		debugInfo := hl.formatJSON(RedactBody(bs.Bytes()))
 		if debugInfo != "" {
 			hl.Logger.Debugf("Response Body: %s", debugInfo)
 		}
@@ -145,7 +161,7 @@ func (hl *HTTPLog) logResponseBody(original io.ReadCloser, headers http.Header)
 }
 
 func (hl *HTTPLog) formatJSON(raw []byte) string {
-	var data map[string]interface{}
+	var data interface{}
 
 	err := json.Unmarshal(raw, &data)
 	if err != nil {
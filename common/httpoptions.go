@@ -0,0 +1,166 @@
+package common
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Timeouts are the time budgets for each kind of API request
+type Timeouts struct {
+	// Connect limits establishing a connection, including the TLS handshake
+	Connect time.Duration
+
+	// Auth limits requests to the identity service
+	Auth time.Duration
+
+	// API limits requests to the cluster API
+	API time.Duration
+
+	// Credentials limits generating and downloading cluster credentials, which is slow on a loaded API
+	Credentials time.Duration
+}
+
+// DefaultTimeouts are used for any timeout which is not specified
+var DefaultTimeouts = Timeouts{
+	Connect:     10 * time.Second,
+	Auth:        30 * time.Second,
+	API:         30 * time.Second,
+	Credentials: 2 * time.Minute,
+}
+
+// withDefaults replaces unspecified timeouts with the default
+func (timeouts Timeouts) withDefaults() Timeouts {
+	if timeouts.Connect <= 0 {
+		timeouts.Connect = DefaultTimeouts.Connect
+	}
+	if timeouts.Auth <= 0 {
+		timeouts.Auth = DefaultTimeouts.Auth
+	}
+	if timeouts.API <= 0 {
+		timeouts.API = DefaultTimeouts.API
+	}
+	if timeouts.Credentials <= 0 {
+		timeouts.Credentials = DefaultTimeouts.Credentials
+	}
+	return timeouts
+}
+
+// Override returns the timeouts, replaced by each timeout which is specified in overrides,
+// e.g. the flags which take precedence over the profile
+func (timeouts Timeouts) Override(overrides Timeouts) Timeouts {
+	if overrides.Connect > 0 {
+		timeouts.Connect = overrides.Connect
+	}
+	if overrides.Auth > 0 {
+		timeouts.Auth = overrides.Auth
+	}
+	if overrides.API > 0 {
+		timeouts.API = overrides.API
+	}
+	if overrides.Credentials > 0 {
+		timeouts.Credentials = overrides.Credentials
+	}
+	return timeouts
+}
+
+// ParseTimeout reads a timeout, either a duration such as 90s or 2m, or a number of seconds. The timeout must be greater than zero.
+func ParseTimeout(value string) (time.Duration, error) {
+	timeout, err := time.ParseDuration(value)
+	if seconds, atoiErr := strconv.Atoi(value); atoiErr == nil {
+		timeout, err = time.Duration(seconds)*time.Second, nil
+	}
+	if err != nil {
+		return 0, errors.Errorf("%s is not a valid timeout, e.g. 90s or 2m", value)
+	}
+	if timeout <= 0 {
+		return 0, errors.Errorf("%s is not a valid timeout, it must be greater than zero", value)
+	}
+	return timeout, nil
+}
+
+// HTTPOptions customizes the http clients used to communicate with an API
+type HTTPOptions struct {
+	TLS      TLSOptions
+	Timeouts Timeouts
+}
+
+// Load prepares the options, it must be called before NewHTTPClient
+func (options *HTTPOptions) Load() error {
+	options.Timeouts = options.Timeouts.withDefaults()
+	return options.TLS.Load()
+}
+
+// NewHTTPClient returns the client from NewHTTPClient, using the options and the specified timeout, e.g. Timeouts.Auth
+func (options *HTTPOptions) NewHTTPClient(timeout time.Duration) *http.Client {
+	return options.NewHTTPClientWithRetries(timeout, DefaultRetryPolicy)
+}
+
+// NewHTTPClientWithRetries returns the client from NewHTTPClient, using the options, the specified timeout and a custom retry policy
+func (options *HTTPOptions) NewHTTPClientWithRetries(timeout time.Duration, policy RetryPolicy) *http.Client {
+	return newHTTPClient(options.TLS.config, policy, options.Timeouts.withDefaults().Connect, timeout)
+}
+
+// OverrideTimeout changes the timeout of a client, returning a function which restores the original timeout
+func OverrideTimeout(client *http.Client, timeout time.Duration) (restore func()) {
+	original := client.Timeout
+	client.Timeout = timeout
+	return func() {
+		client.Timeout = original
+	}
+}
+
+// defaultTransportLock serializes overriding the default transport, e.g. when listing clusters in multiple regions at once
+var defaultTransportLock sync.Mutex
+
+// OverrideDefaultTransport wraps the transport used by the default http client, such as when libcarina authenticates,
+// returning a function which restores the original transport. Other overrides wait until it is restored.
+func OverrideDefaultTransport(wrap func(http.RoundTripper) http.RoundTripper) (restore func()) {
+	defaultTransportLock.Lock()
+	original := http.DefaultTransport
+	http.DefaultTransport = wrap(original)
+	return func() {
+		http.DefaultTransport = original
+		defaultTransportLock.Unlock()
+	}
+}
+
+// NewTimeoutTransport limits how long each request may take, for clients which cannot be given a timeout,
+// such as the default http client used when libcarina authenticates
+func NewTimeoutTransport(rt http.RoundTripper, timeout time.Duration) http.RoundTripper {
+	return &timeoutTransport{rt: rt, timeout: timeout}
+}
+
+type timeoutTransport struct {
+	rt      http.RoundTripper
+	timeout time.Duration
+}
+
+// RoundTrip performs a round-trip HTTP request, which is canceled when the response body hasn't been read before the timeout
+func (transport *timeoutTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(request.Context(), transport.timeout)
+	response, err := transport.rt.RoundTrip(request.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	response.Body = &cancelOnClose{ReadCloser: response.Body, cancel: cancel}
+	return response, nil
+}
+
+// cancelOnClose releases the request's timeout once its response body is closed
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (body *cancelOnClose) Close() error {
+	defer body.cancel()
+	return body.ReadCloser.Close()
+}
@@ -0,0 +1,133 @@
+package common
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTimeout(t *testing.T) {
+	testcases := []struct {
+		value    string
+		expected time.Duration
+		valid    bool
+	}{
+		{value: "90", expected: 90 * time.Second, valid: true},
+		{value: "90s", expected: 90 * time.Second, valid: true},
+		{value: "2m", expected: 2 * time.Minute, valid: true},
+		{value: "1m30s", expected: 90 * time.Second, valid: true},
+		{value: "0"},
+		{value: "0s"},
+		{value: "-5"},
+		{value: "-5s"},
+		{value: "soon"},
+		{value: ""},
+	}
+
+	for _, tc := range testcases {
+		timeout, err := ParseTimeout(tc.value)
+		if !tc.valid {
+			assert.Error(t, err, "Expected %q to be rejected", tc.value)
+			continue
+		}
+		assert.NoError(t, err, "Expected %q to be accepted", tc.value)
+		assert.Equal(t, tc.expected, timeout, "Unexpected timeout for %q", tc.value)
+	}
+}
+
+func TestTimeoutPrecedence(t *testing.T) {
+	testcases := []struct {
+		name     string
+		profile  Timeouts
+		flags    Timeouts
+		expected Timeouts
+	}{
+		{
+			name:     "defaults",
+			expected: DefaultTimeouts,
+		},
+		{
+			name:     "profile",
+			profile:  Timeouts{Connect: 5 * time.Second, API: time.Minute},
+			expected: Timeouts{Connect: 5 * time.Second, Auth: DefaultTimeouts.Auth, API: time.Minute, Credentials: DefaultTimeouts.Credentials},
+		},
+		{
+			name:     "flags",
+			flags:    Timeouts{Auth: time.Minute, API: time.Minute, Credentials: time.Minute},
+			expected: Timeouts{Connect: DefaultTimeouts.Connect, Auth: time.Minute, API: time.Minute, Credentials: time.Minute},
+		},
+		{
+			name:     "flags override the profile",
+			profile:  Timeouts{Connect: 5 * time.Second, Auth: 20 * time.Second, Credentials: 5 * time.Minute},
+			flags:    Timeouts{Auth: time.Minute, API: time.Minute, Credentials: time.Minute},
+			expected: Timeouts{Connect: 5 * time.Second, Auth: time.Minute, API: time.Minute, Credentials: time.Minute},
+		},
+		{
+			name:     "connect flag overrides the profile",
+			profile:  Timeouts{Connect: 5 * time.Second, Auth: 20 * time.Second},
+			flags:    Timeouts{Connect: time.Second},
+			expected: Timeouts{Connect: time.Second, Auth: 20 * time.Second, API: DefaultTimeouts.API, Credentials: DefaultTimeouts.Credentials},
+		},
+	}
+
+	for _, tc := range testcases {
+		timeouts := tc.profile.Override(tc.flags).withDefaults()
+		assert.Equal(t, tc.expected, timeouts, tc.name)
+	}
+}
+
+func TestTimeoutTransport(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			select {
+			case <-release:
+			case <-time.After(5 * time.Second):
+			}
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+	defer close(release)
+
+	client := &http.Client{Transport: NewTimeoutTransport(http.DefaultTransport, 100*time.Millisecond)}
+
+	response, err := client.Get(server.URL + "/fast")
+	assert.NoError(t, err)
+	body, err := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", string(body))
+
+	start := time.Now()
+	_, err = client.Get(server.URL + "/slow")
+	assert.Error(t, err, "Expected the slow request to time out")
+	assert.True(t, time.Since(start) < 2*time.Second, "Expected the request to be canceled at the timeout")
+}
+
+func TestOverrideDefaultTransportIsSerialized(t *testing.T) {
+	original := http.DefaultTransport
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var wrapped http.RoundTripper
+			restore := OverrideDefaultTransport(func(transport http.RoundTripper) http.RoundTripper {
+				wrapped = NewTimeoutTransport(transport, time.Second)
+				return wrapped
+			})
+			assert.True(t, http.DefaultTransport == wrapped, "Expected the default transport to stay overridden until it is restored")
+			restore()
+		}()
+	}
+	wg.Wait()
+
+	assert.True(t, http.DefaultTransport == original, "Expected the original default transport to be restored")
+}
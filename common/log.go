@@ -4,6 +4,7 @@ import (
 	"io/ioutil"
 	"os"
 	"strings"
+	"sync"
 	"testing"
 
 	"github.com/Sirupsen/logrus"
@@ -25,8 +26,28 @@ var Log = &consoleLogger{
 
 type consoleLogger struct {
 	*logrus.Logger
-	IsSilent     bool
-	ErrorContext map[string]interface{}
+	IsSilent         bool
+	ErrorContext     map[string]interface{}
+	errorContextLock sync.Mutex
+}
+
+// SetErrorContext records additional information to display when an error occurs, such as the request id
+func (log *consoleLogger) SetErrorContext(key string, value interface{}) {
+	log.errorContextLock.Lock()
+	defer log.errorContextLock.Unlock()
+	log.ErrorContext[key] = value
+}
+
+// GetErrorContext returns a copy of the additional information to display when an error occurs
+func (log *consoleLogger) GetErrorContext() map[string]interface{} {
+	log.errorContextLock.Lock()
+	defer log.errorContextLock.Unlock()
+
+	context := make(map[string]interface{}, len(log.ErrorContext))
+	for key, value := range log.ErrorContext {
+		context[key] = value
+	}
+	return context
 }
 
 // SetDebug sends debug messages to stdout
@@ -64,7 +85,7 @@ func (log *consoleLogger) SDump(a ...interface{}) string {
 // WriteSetting dumps a client setting to stdout
 func (log *consoleLogger) WriteSetting(setting string, source string, value string) {
 	s := strings.ToLower(setting)
-	if strings.Contains(s, "password") || strings.Contains(s, "key") {
+	if strings.Contains(s, "password") || strings.Contains(s, "key") || strings.Contains(s, "secret") || strings.Contains(s, "token") || strings.Contains(s, "passphrase") {
 		value = "***"
 	}
 
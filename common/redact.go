@@ -0,0 +1,154 @@
+package common
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// redacted replaces secrets in debug output
+const redacted = "***"
+
+// secretFieldNames are the normalized names of JSON fields which hold secrets, matched anywhere in a field name
+var secretFieldNames = []string{"apikey", "password", "secret", "passphrase", "privatekey"}
+
+// secretHeaders are the headers which hold credentials
+var secretHeaders = []string{"Authorization", "Cookie", "Set-Cookie", "X-Auth-Key", "X-Auth-Token", "X-Subject-Token", "X-Storage-Token"}
+
+// privateKeyPattern finds PEM encoded private keys. Certificates are public, and kept so that they can be replayed.
+var privateKeyPattern = regexp.MustCompile(`(-----BEGIN [A-Z0-9 ]*PRIVATE KEY-----)[\s\S]*?(-----END [A-Z0-9 ]*PRIVATE KEY-----)`)
+
+// secretFieldPattern finds secret fields in a body which is not valid JSON, e.g. a truncated error message
+var secretFieldPattern = regexp.MustCompile(`(?i)("[a-z_-]*(?:api_?key|password|secret|passphrase|private_?key)[a-z_-]*"\s*:\s*)"(?:[^"\\]|\\.)*"`)
+
+// RedactHeaders returns a copy of the headers with the credentials masked
+func RedactHeaders(headers http.Header) http.Header {
+	result := make(http.Header, len(headers))
+	for key, values := range headers {
+		result[key] = values
+	}
+
+	for _, key := range secretHeaders {
+		if result.Get(key) != "" {
+			result.Set(key, redacted)
+		}
+	}
+	return result
+}
+
+// RedactBody masks the secrets in a request or response body: secret JSON fields, token ids and PEM encoded private keys
+func RedactBody(body []byte) []byte {
+	var data interface{}
+	if err := json.Unmarshal(body, &data); err != nil {
+		result := secretFieldPattern.ReplaceAll(body, []byte(`$1"`+redacted+`"`))
+		return redactPEM(result)
+	}
+
+	result, err := json.Marshal(redactValue("", data))
+	if err != nil {
+		return redactPEM(body)
+	}
+	return result
+}
+
+// redactValue recursively masks the secrets in a decoded JSON value, parent is the name of the enclosing field
+func redactValue(parent string, value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			// Keystone nests the credentials in a password object, only mask values
+			_, isObject := child.(map[string]interface{})
+			if isSecretField(parent, key) && !isObject {
+				v[key] = redacted
+			} else {
+				v[key] = redactValue(key, child)
+			}
+		}
+		return v
+	case []interface{}:
+		for i, child := range v {
+			v[i] = redactValue(parent, child)
+		}
+		return v
+	case string:
+		return string(redactPEM([]byte(v)))
+	default:
+		return v
+	}
+}
+
+func isSecretField(parent string, key string) bool {
+	name := normalizeFieldName(key)
+
+	// The token id, e.g. {"token": {"id": "abc123"}}
+	if name == "id" && normalizeFieldName(parent) == "token" {
+		return true
+	}
+
+	for _, secret := range secretFieldNames {
+		if strings.Contains(name, secret) {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizeFieldName(name string) string {
+	name = strings.ToLower(name)
+	name = strings.Replace(name, "_", "", -1)
+	return strings.Replace(name, "-", "", -1)
+}
+
+// redactPEM keeps the type of each PEM encoded private key, e.g. RSA PRIVATE KEY, but masks its contents
+func redactPEM(value []byte) []byte {
+	return privateKeyPattern.ReplaceAll(value, []byte("${1}"+redacted+"${2}"))
+}
+
+// redactArchive masks the secrets in each file of a zip archive, e.g. the private key in a cluster's credentials bundle.
+// Other bodies are redacted as text.
+func redactArchive(body []byte) ([]byte, error) {
+	archive, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		return RedactBody(body), nil
+	}
+
+	var result bytes.Buffer
+	writer := zip.NewWriter(&result)
+	for _, file := range archive.File {
+		contents, err := readArchiveFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		header := file.FileHeader
+		w, err := writer.CreateHeader(&header)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Unable to redact %s in the archive", file.Name)
+		}
+		_, err = w.Write(RedactBody(contents))
+		if err != nil {
+			return nil, errors.Wrapf(err, "Unable to redact %s in the archive", file.Name)
+		}
+	}
+
+	err = writer.Close()
+	if err != nil {
+		return nil, errors.Wrap(err, "Unable to redact the archive")
+	}
+	return result.Bytes(), nil
+}
+
+func readArchiveFile(file *zip.File) ([]byte, error) {
+	r, err := file.Open()
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to read %s in the archive", file.Name)
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
@@ -0,0 +1,201 @@
+package common
+
+import (
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RetryPolicy controls when failed requests are retried
+type RetryPolicy struct {
+	// Retries is the number of times a request is retried after the first attempt
+	Retries int
+
+	// BaseDelay is the initial backoff, which doubles after every attempt up to MaxDelay
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+
+	// MaxTotalDelay limits the time spent waiting between all attempts, so that the last attempt has time to complete
+	// before the client's timeout. Zero is unlimited.
+	MaxTotalDelay time.Duration
+
+	// RetryDeletes allows DELETE requests to be retried, for backends which handle a repeated delete gracefully
+	RetryDeletes bool
+}
+
+// DefaultRetryPolicy is used by the clients from NewHTTPClient
+var DefaultRetryPolicy = RetryPolicy{
+	Retries:   3,
+	BaseDelay: 500 * time.Millisecond,
+	MaxDelay:  10 * time.Second,
+}
+
+// WithDeletes returns a copy of the policy which also retries DELETE requests
+func (policy RetryPolicy) WithDeletes() RetryPolicy {
+	policy.RetryDeletes = true
+	return policy
+}
+
+// withTimeout returns a copy of the policy which waits between attempts for at most half of the client's timeout
+func (policy RetryPolicy) withTimeout(timeout time.Duration) RetryPolicy {
+	limit := timeout / 2
+	if limit > 0 && (policy.MaxTotalDelay == 0 || policy.MaxTotalDelay > limit) {
+		policy.MaxTotalDelay = limit
+	}
+	return policy
+}
+
+// RetryTransport satisfies the http.RoundTripper interface and retries idempotent requests
+// which failed with a connection reset, 502, 503, 504, or 429 with Retry-After, using jittered exponential backoff.
+type RetryTransport struct {
+	Policy RetryPolicy
+	rt     http.RoundTripper
+	sleep  func(request *http.Request, delay time.Duration) error
+}
+
+// NewRetryTransport wraps a RoundTripper with retries
+func NewRetryTransport(rt http.RoundTripper, policy RetryPolicy) *RetryTransport {
+	return &RetryTransport{Policy: policy, rt: rt, sleep: sleepUnlessCanceled}
+}
+
+// RoundTrip performs a round-trip HTTP request, retrying transient failures
+func (retrier *RetryTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	if !retrier.canRetry(request) {
+		return retrier.rt.RoundTrip(request)
+	}
+
+	var waited time.Duration
+	for attempt := 0; ; attempt++ {
+		// Send a copy, so that changes made to the request by the wrapped transport, e.g. headers, aren't repeated
+		response, err := retrier.rt.RoundTrip(copyRequest(request))
+		if attempt >= retrier.Policy.Retries {
+			return response, err
+		}
+
+		delay, reason, retry := retrier.shouldRetry(attempt, response, err)
+		if !retry {
+			return response, err
+		}
+
+		waited += delay
+		if retrier.Policy.MaxTotalDelay > 0 && waited > retrier.Policy.MaxTotalDelay {
+			Log.WriteDebug("Not retrying %s %s, waiting %s would exceed the timeout: %s", request.Method, redactURL(request), delay, reason)
+			return response, err
+		}
+
+		if response != nil {
+			io.Copy(ioutil.Discard, response.Body)
+			response.Body.Close()
+		}
+
+		Log.WriteDebug("Retrying %s %s in %s (%d of %d): %s", request.Method, redactURL(request), delay, attempt+1, retrier.Policy.Retries, reason)
+		if err := retrier.sleep(request, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// canRetry checks if the request is idempotent, and can be sent again
+func (retrier *RetryTransport) canRetry(request *http.Request) bool {
+	if request.Body != nil {
+		return false
+	}
+
+	switch request.Method {
+	case "GET", "HEAD":
+		return true
+	case "DELETE":
+		return retrier.Policy.RetryDeletes
+	default:
+		return false
+	}
+}
+
+// copyRequest makes a shallow copy of a request without a body, with its own headers
+func copyRequest(request *http.Request) *http.Request {
+	clone := new(http.Request)
+	*clone = *request
+	clone.Header = make(http.Header, len(request.Header))
+	for key, values := range request.Header {
+		clone.Header[key] = append([]string(nil), values...)
+	}
+	return clone
+}
+
+// shouldRetry determines if a failed attempt is transient, and how long to wait before retrying
+func (retrier *RetryTransport) shouldRetry(attempt int, response *http.Response, err error) (time.Duration, string, bool) {
+	if err != nil {
+		if !isConnectionReset(err) {
+			return 0, "", false
+		}
+		return retrier.backoff(attempt), err.Error(), true
+	}
+
+	switch response.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		if delay, ok := parseRetryAfter(response.Header.Get("Retry-After")); ok {
+			return delay, response.Status, delay <= retrier.Policy.MaxDelay
+		}
+		return retrier.backoff(attempt), response.Status, true
+	case http.StatusTooManyRequests:
+		// Only retry when the server tells us how long to wait
+		delay, ok := parseRetryAfter(response.Header.Get("Retry-After"))
+		return delay, response.Status, ok && delay <= retrier.Policy.MaxDelay
+	default:
+		return 0, "", false
+	}
+}
+
+// backoff picks a random delay, up to the exponentially increasing limit for the attempt
+func (retrier *RetryTransport) backoff(attempt int) time.Duration {
+	limit := retrier.Policy.BaseDelay << uint(attempt)
+	if limit <= 0 || limit > retrier.Policy.MaxDelay {
+		limit = retrier.Policy.MaxDelay
+	}
+	if limit <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(limit)))
+}
+
+// parseRetryAfter reads a Retry-After header, either a number of seconds or an HTTP date
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		delay := date.Sub(time.Now())
+		if delay < 0 {
+			delay = 0
+		}
+		return delay, true
+	}
+
+	return 0, false
+}
+
+func isConnectionReset(err error) bool {
+	msg := err.Error()
+	return err == io.EOF || strings.Contains(msg, "connection reset by peer") || strings.HasSuffix(msg, ": EOF")
+}
+
+func sleepUnlessCanceled(request *http.Request, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-request.Context().Done():
+		return request.Context().Err()
+	}
+}
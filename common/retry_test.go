@@ -0,0 +1,168 @@
+package common
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestRetryTransport(policy RetryPolicy) (*RetryTransport, *[]time.Duration) {
+	var delays []time.Duration
+	retrier := NewRetryTransport(http.DefaultTransport, policy)
+	retrier.sleep = func(request *http.Request, delay time.Duration) error {
+		delays = append(delays, delay)
+		return nil
+	}
+	return retrier, &delays
+}
+
+func newFlakyServer(failures int, status int, retryAfter string) (*httptest.Server, *int) {
+	var attempts int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts <= failures {
+			if retryAfter != "" {
+				w.Header().Set("Retry-After", retryAfter)
+			}
+			w.WriteHeader(status)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	return server, &attempts
+}
+
+func TestRetryTransientFailures(t *testing.T) {
+	server, attempts := newFlakyServer(2, http.StatusServiceUnavailable, "")
+	defer server.Close()
+
+	retrier, delays := newTestRetryTransport(DefaultRetryPolicy)
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	resp, err := retrier.RoundTrip(req)
+
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, 3, *attempts)
+	assert.Len(t, *delays, 2)
+	for _, delay := range *delays {
+		assert.True(t, delay <= DefaultRetryPolicy.MaxDelay)
+	}
+}
+
+func TestRetryGivesUpAfterMaxRetries(t *testing.T) {
+	server, attempts := newFlakyServer(10, http.StatusBadGateway, "")
+	defer server.Close()
+
+	retrier, _ := newTestRetryTransport(RetryPolicy{Retries: 2, BaseDelay: time.Millisecond, MaxDelay: time.Second})
+	req, _ := http.NewRequest("HEAD", server.URL, nil)
+	resp, err := retrier.RoundTrip(req)
+
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+	assert.Equal(t, 3, *attempts)
+}
+
+func TestRetryTooManyRequestsHonorsRetryAfter(t *testing.T) {
+	server, attempts := newFlakyServer(1, http.StatusTooManyRequests, "2")
+	defer server.Close()
+
+	retrier, delays := newTestRetryTransport(DefaultRetryPolicy)
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	resp, err := retrier.RoundTrip(req)
+
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, 2, *attempts)
+	assert.Equal(t, []time.Duration{2 * time.Second}, *delays)
+}
+
+func TestRetryTooManyRequestsWithoutRetryAfter(t *testing.T) {
+	server, attempts := newFlakyServer(1, http.StatusTooManyRequests, "")
+	defer server.Close()
+
+	retrier, _ := newTestRetryTransport(DefaultRetryPolicy)
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	resp, _ := retrier.RoundTrip(req)
+
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(t, 1, *attempts)
+}
+
+func TestRetryOnlyIdempotentRequests(t *testing.T) {
+	testCases := []struct {
+		method   string
+		policy   RetryPolicy
+		attempts int
+	}{
+		{"POST", DefaultRetryPolicy, 1},
+		{"DELETE", DefaultRetryPolicy, 1},
+		{"DELETE", DefaultRetryPolicy.WithDeletes(), 2},
+	}
+
+	for _, tc := range testCases {
+		server, attempts := newFlakyServer(1, http.StatusServiceUnavailable, "")
+
+		retrier, _ := newTestRetryTransport(tc.policy)
+		var req *http.Request
+		if tc.method == "POST" {
+			req, _ = http.NewRequest(tc.method, server.URL, strings.NewReader("{}"))
+		} else {
+			req, _ = http.NewRequest(tc.method, server.URL, nil)
+		}
+		retrier.RoundTrip(req)
+
+		assert.Equal(t, tc.attempts, *attempts, "%s with %+v", tc.method, tc.policy)
+		server.Close()
+	}
+}
+
+func TestRetryStopsBeforeTheTimeout(t *testing.T) {
+	server, attempts := newFlakyServer(10, http.StatusServiceUnavailable, "3")
+	defer server.Close()
+
+	policy := RetryPolicy{Retries: 5, BaseDelay: time.Second, MaxDelay: 10 * time.Second}.withTimeout(10 * time.Second)
+	retrier, delays := newTestRetryTransport(policy)
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	resp, err := retrier.RoundTrip(req)
+
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, []time.Duration{3 * time.Second}, *delays, "Expected the total delay to stay within half of the timeout")
+	assert.Equal(t, 2, *attempts)
+}
+
+func TestRetryDoesNotRepeatHeaders(t *testing.T) {
+	var userAgents [][]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgents = append(userAgents, r.Header["User-Agent"])
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	retrier, _ := newTestRetryTransport(RetryPolicy{Retries: 2})
+	retrier.rt = &HTTPLog{rt: http.DefaultTransport, Logger: Log.Logger}
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	retrier.RoundTrip(req)
+
+	assert.Len(t, userAgents, 3)
+	for _, userAgent := range userAgents {
+		assert.Len(t, userAgent, 1, "Expected a single User-Agent header on every attempt")
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	delay, ok := parseRetryAfter("120")
+	assert.True(t, ok)
+	assert.Equal(t, 2*time.Minute, delay)
+
+	delay, ok = parseRetryAfter(time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat))
+	assert.True(t, ok)
+	assert.Equal(t, time.Duration(0), delay)
+
+	_, ok = parseRetryAfter("soon")
+	assert.False(t, ok)
+}
@@ -0,0 +1,87 @@
+package common
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// TLSOptions customizes the TLS connections to the API endpoints
+type TLSOptions struct {
+	// CACert is a PEM encoded bundle of the certificate authorities to trust, instead of the system certificates
+	CACert string
+
+	// ClientCert and ClientKey are a PEM encoded certificate and private key, presented to mutually authenticated endpoints
+	ClientCert string
+	ClientKey  string
+
+	// Insecure skips verifying the server certificates
+	Insecure bool
+
+	config *tls.Config
+}
+
+// IsDefault checks if the default TLS configuration is used
+func (options *TLSOptions) IsDefault() bool {
+	return options.CACert == "" && options.ClientCert == "" && options.ClientKey == "" && !options.Insecure
+}
+
+// Load reads the certificates
+func (options *TLSOptions) Load() error {
+	if options.config != nil || options.IsDefault() {
+		return nil
+	}
+
+	config := &tls.Config{}
+
+	if options.CACert != "" {
+		contents, err := ioutil.ReadFile(options.CACert)
+		if err != nil {
+			return errors.Wrapf(err, "Unable to read the CA certificate %s", options.CACert)
+		}
+
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(contents) {
+			return fmt.Errorf("No PEM encoded certificates found in %s", options.CACert)
+		}
+	}
+
+	if options.ClientCert != "" || options.ClientKey != "" {
+		if options.ClientCert == "" || options.ClientKey == "" {
+			return errors.New("Both a client certificate and a client key are required")
+		}
+
+		cert, err := tls.LoadX509KeyPair(options.ClientCert, options.ClientKey)
+		if err != nil {
+			return errors.Wrapf(err, "Unable to load the client certificate %s and key %s", options.ClientCert, options.ClientKey)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	if options.Insecure {
+		Log.WriteWarning("TLS certificate verification is disabled by --insecure, the connection to the API is not secure")
+		config.InsecureSkipVerify = true
+	}
+
+	options.config = config
+	return nil
+}
+
+// ApplyToDefaultTransport uses the TLS options for requests made with the default http client,
+// such as when libcarina authenticates. It must be called before any requests are made.
+func (options *TLSOptions) ApplyToDefaultTransport() {
+	if options.config == nil {
+		return
+	}
+
+	if defaultTransport != nil {
+		defaultTransport.TLSClientConfig = options.config
+	}
+}
+
+// defaultTransport is the original default transport, before it is wrapped by a cassette
+var defaultTransport, _ = http.DefaultTransport.(*http.Transport)
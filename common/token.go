@@ -0,0 +1,117 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// TokenRefreshWindow is how long before a cached token expires that carina reauthenticates,
+// rather than risk the token expiring in the middle of a command
+const TokenRefreshWindow = 5 * time.Minute
+
+// IsTokenFresh returns true when the token is known to be valid beyond the refresh window, and does not need to be verified
+func IsTokenFresh(expires time.Time) bool {
+	return !expires.IsZero() && time.Now().Add(TokenRefreshWindow).Before(expires)
+}
+
+// IsTokenExpiring returns true when the token is known to expire within the refresh window
+func IsTokenExpiring(expires time.Time) bool {
+	return !expires.IsZero() && !IsTokenFresh(expires)
+}
+
+// FormatTokenExpiry formats a token expiry for the cache, an unknown expiry is empty
+func FormatTokenExpiry(expires time.Time) string {
+	if expires.IsZero() {
+		return ""
+	}
+	return expires.UTC().Format(time.RFC3339)
+}
+
+// ParseTokenExpiry reads a cached token expiry, returning the zero time when it is unknown
+func ParseTokenExpiry(value string) time.Time {
+	expires, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}
+	}
+	return expires
+}
+
+// ParseTokenResponse reads the token and its expiry from an OpenStack Identity v3 response,
+// or an OpenStack Identity v2 and Rackspace Identity response
+func ParseTokenResponse(header http.Header, body []byte) (token string, expires time.Time, err error) {
+	var result struct {
+		// v3
+		Token struct {
+			ExpiresAt time.Time `json:"expires_at"`
+		} `json:"token"`
+
+		// v2
+		Access struct {
+			Token struct {
+				ID      string    `json:"id"`
+				Expires time.Time `json:"expires"`
+			} `json:"token"`
+		} `json:"access"`
+	}
+
+	err = json.Unmarshal(body, &result)
+	if err != nil {
+		return "", time.Time{}, errors.Wrap(err, "Unable to parse the token response")
+	}
+
+	if subjectToken := header.Get("X-Subject-Token"); subjectToken != "" {
+		return subjectToken, result.Token.ExpiresAt, nil
+	}
+	if result.Access.Token.ID != "" {
+		return result.Access.Token.ID, result.Access.Token.Expires, nil
+	}
+
+	return "", time.Time{}, errors.New("The token response does not contain a token")
+}
+
+// TokenRecorder satisfies the http.RoundTripper interface and reports the tokens issued
+// by requests to an identity service, including those made when reauthenticating
+type TokenRecorder struct {
+	rt      http.RoundTripper
+	onToken func(token string, expires time.Time)
+}
+
+// NewTokenRecorder wraps a RoundTripper, calling onToken whenever a new token is issued
+func NewTokenRecorder(rt http.RoundTripper, onToken func(token string, expires time.Time)) *TokenRecorder {
+	return &TokenRecorder{rt: rt, onToken: onToken}
+}
+
+// RoundTrip performs a round-trip HTTP request and inspects token responses
+func (recorder *TokenRecorder) RoundTrip(request *http.Request) (*http.Response, error) {
+	response, err := recorder.rt.RoundTrip(request)
+	if err != nil || response == nil {
+		return response, err
+	}
+
+	isTokenRequest := request.Method == "POST" && strings.HasSuffix(strings.TrimSuffix(request.URL.Path, "/"), "tokens")
+	if !isTokenRequest || response.StatusCode < 200 || response.StatusCode > 299 {
+		return response, nil
+	}
+
+	body, err := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	response.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	token, expires, err := ParseTokenResponse(response.Header, body)
+	if err != nil {
+		Log.WriteDebug("Unable to determine when the token expires: %s", err)
+		return response, nil
+	}
+
+	recorder.onToken(token, expires)
+	return response, nil
+}
@@ -90,6 +90,47 @@ func WriteClusters(clusters []common.Cluster) {
 	output.Flush()
 }
 
+// SourcedClusters are the clusters retrieved from a single profile and region
+type SourcedClusters struct {
+	Profile  string
+	Region   string
+	Clusters []common.Cluster
+}
+
+// WriteSourcedClusters prints the clusters from multiple profiles and regions to the console
+func WriteSourcedClusters(results []SourcedClusters) {
+	output := new(tabwriter.Writer)
+	output.Init(os.Stdout, 5, 8, 2, ' ', 0)
+
+	headerFields := []string{
+		"Profile",
+		"Region",
+		"ID",
+		"Name",
+		"Status",
+		"Template",
+		"Nodes",
+	}
+	writeInColumns(output, headerFields)
+
+	for _, result := range results {
+		for _, cluster := range result.Clusters {
+			fields := []string{
+				result.Profile,
+				result.Region,
+				cluster.GetID(),
+				cluster.GetName(),
+				cluster.GetStatus(),
+				cluster.GetTemplate().GetName(),
+				cluster.GetNodes(),
+			}
+			writeInColumns(output, fields)
+		}
+	}
+
+	output.Flush()
+}
+
 func writeInColumns(output *tabwriter.Writer, columns []string) {
 	s := strings.Join(columns, "\t")
 	b := []byte(s + "\n")
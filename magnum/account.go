@@ -4,6 +4,8 @@ import (
 	"crypto/sha1"
 	"fmt"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/getcarina/carina/common"
 	"github.com/gophercloud/gophercloud"
@@ -20,8 +22,36 @@ type Account struct {
 	Project          string
 	Domain           string
 	Region           string
-	token            string
-	endpoint         string
+
+	// OpenStack Identity v3 ids and separate user and project domains, which take precedence over Domain
+	UserID          string
+	ProjectID       string
+	UserDomain      string
+	UserDomainID    string
+	ProjectDomain   string
+	ProjectDomainID string
+
+	// Application credentials are used instead of a username and password
+	ApplicationCredentialID     string
+	ApplicationCredentialSecret string
+
+	// Token is a pre-issued token, used instead of authenticating
+	Token string
+
+	// Interface selects the endpoint from the service catalog: public, internal or admin
+	Interface string
+
+	// HTTP customizes the connections to Keystone and Magnum
+	HTTP common.HTTPOptions
+
+	// When CSR is set, the credentials private key is generated locally and only a certificate signing request is sent to Magnum
+	CSR           bool
+	CSRKeyType    string
+	CSRCommonName string
+
+	token        string
+	tokenExpires time.Time
+	endpoint     string
 }
 
 // NewClusterService create the appropriate ClusterService for the account
@@ -29,21 +59,69 @@ func (account *Account) NewClusterService() common.ClusterService {
 	return &Magnum{Account: account}
 }
 
-// GetID returns a unique id for the account, e.g. private-[authendpoint hash]-[username]
+// GetID returns a unique id for the account, e.g. private-[authendpoint hash]-[username],
+// or private-[authendpoint hash]-[region]-[username] when a region is specified.
+// The project id is appended when specified.
 func (account *Account) GetID() string {
+	hash := sha1.Sum([]byte(account.AuthEndpoint))
+	id := fmt.Sprintf("private-%x", hash[:4])
+	if account.Region != "" {
+		id += "-" + strings.ToLower(account.Region)
+	}
+	id += "-" + account.getPrincipal()
+	if account.ProjectID != "" {
+		id += "-" + account.ProjectID
+	}
+	return id
+}
+
+// GetLegacyID returns the id used by earlier releases, which only included the username, e.g. private-[authendpoint hash]-[username]
+func (account *Account) GetLegacyID() string {
 	hash := sha1.Sum([]byte(account.AuthEndpoint))
 	return fmt.Sprintf("private-%x-%s", hash[:4], account.UserName)
 }
 
-// GetClusterPrefix returns a unique string to identity the account's clusters, e.g. private-[endpoint hash]-[username]
+// MatchesLegacyEndpoint checks that an endpoint cached under the legacy id is for the account's region.
+// The endpoint does not identify its region, so it is only reused when no region is selected.
+func (account *Account) MatchesLegacyEndpoint(endpoint string) bool {
+	return account.Region == ""
+}
+
+// getPrincipal identifies who is authenticating, e.g. the username, username@domain, or the application credential id
+func (account *Account) getPrincipal() string {
+	switch {
+	case account.ApplicationCredentialID != "":
+		return "appcred-" + account.ApplicationCredentialID
+	case account.Token != "":
+		hash := sha1.Sum([]byte(account.Token))
+		return fmt.Sprintf("token-%x", hash[:4])
+	case account.UserID != "":
+		return account.UserID
+	case account.UserDomainID != "":
+		return account.UserName + "@" + account.UserDomainID
+	case account.UserDomain != "":
+		return account.UserName + "@" + account.UserDomain
+	default:
+		return account.UserName
+	}
+}
+
+// GetClusterPrefix returns a unique string to identity the account's clusters, e.g. private-[endpoint hash]-[username].
+// Accounts which use identity v3 only settings are identified by their principal, e.g. private-[endpoint hash]-[username]@[domain]
 func (account *Account) GetClusterPrefix() (string, error) {
 	endpoint := account.getEndpoint()
 	if endpoint == "" {
 		return "", errors.New("Cannot call account.GetClusterPrefix before authenticating and setting account.Endpoint")
 	}
 
+	// Keep using the directory created by earlier releases, which always used the username
+	principal := account.UserName
+	if account.needsIdentityV3() {
+		principal = account.getPrincipal()
+	}
+
 	hash := sha1.Sum([]byte(endpoint))
-	return fmt.Sprintf("private-%x-%s", hash[:4], account.UserName), nil
+	return fmt.Sprintf("private-%x-%s", hash[:4], principal), nil
 }
 
 func (account *Account) getEndpoint() string {
@@ -57,6 +135,10 @@ func (account *Account) getEndpoint() string {
 func (account *Account) Authenticate() (*gophercloud.ServiceClient, error) {
 	var magnumClient *gophercloud.ServiceClient
 
+	if err := account.HTTP.Load(); err != nil {
+		return nil, errors.Wrap(err, "[magnum] Unable to load the TLS configuration")
+	}
+
 	testAuth := func() error {
 		req, err := http.NewRequest("HEAD", account.AuthEndpoint+"/auth/tokens", nil)
 		if err != nil {
@@ -64,7 +146,7 @@ func (account *Account) Authenticate() (*gophercloud.ServiceClient, error) {
 		}
 		req.Header.Add("X-Auth-Token", account.token)
 		req.Header.Add("X-Subject-Token", account.token)
-		resp, err := common.NewHTTPClient().Do(req)
+		resp, err := account.newHTTPClient(account.HTTP.Timeouts.Auth).Do(req)
 		if err != nil {
 			return err
 		}
@@ -82,45 +164,81 @@ func (account *Account) Authenticate() (*gophercloud.ServiceClient, error) {
 		Username:         account.UserName,
 		Password:         account.Password,
 		TenantName:       account.Project,
-		DomainName:       account.Domain,
-		TokenID:          account.token,
+		DomainName:       account.getUserDomain(),
 	}
 
 	if account.token != "" && account.endpoint != "" {
-		common.Log.WriteDebug("[magnum] Attempting to authenticate with a cached token for %s", account.endpoint)
-		if testAuth() == nil {
+		if account.isCachedTokenValid(testAuth) {
+			common.Log.WriteDebug("[magnum] Authenticating with a cached token for %s", account.endpoint)
 			identity, err := openstack.NewClient(account.AuthEndpoint)
 			if err != nil {
 				return nil, errors.Wrap(err, "[magnum] Unable to create a new OpenStack Identity client")
 			}
 
 			identity.TokenID = account.token
-			identity.ReauthFunc = reauthenticate(identity, authOptions)
+			if account.needsIdentityV3() {
+				identity.ReauthFunc = account.reauthenticateIdentityV3(identity)
+			} else {
+				identity.ReauthFunc = reauthenticate(identity, authOptions)
+			}
 			identity.UserAgent.Prepend(common.BuildUserAgent())
-			identity.HTTPClient = *common.NewHTTPClient()
+			identity.HTTPClient = *account.newHTTPClient(account.HTTP.Timeouts.Auth)
 			identity.EndpointLocator = func(opts gophercloud.EndpointOpts) (string, error) {
 				// Skip the service catalog and use the cached endpoint
 				return account.endpoint, nil
 			}
 
-			magnumClient, err = openstack.NewContainerOrchestrationV1(identity, gophercloud.EndpointOpts{Region: account.Region})
+			magnumClient, err = openstack.NewContainerOrchestrationV1(identity, account.endpointOpts())
 			if err != nil {
 				return nil, errors.Wrap(err, "[magnum] Unable to create a Magnum client")
 			}
+		} else {
+			// Clear cache and authenticate with the password
+			common.Log.WriteDebug("[magnum] Discarding expired cached token and endpoint")
+			account.token = ""
+			account.tokenExpires = time.Time{}
+			account.endpoint = ""
+		}
+	}
+
+	if magnumClient == nil && account.needsIdentityV3() {
+		common.Log.WriteDebug("[magnum] Attempting to authenticate with OpenStack Identity v3")
+		identity, err := openstack.NewClient(account.AuthEndpoint)
+		if err != nil {
+			return nil, errors.Wrap(err, "[magnum] Unable to create a new OpenStack Identity client")
 		}
 
-		// Clear cache and authenticate with the password
-		common.Log.WriteDebug("[magnum] Discarding expired cached token and endpoint")
-		account.token = ""
-		account.endpoint = ""
-		return account.Authenticate()
-	} else {
+		token, err := account.authenticateIdentityV3()
+		if err != nil {
+			return nil, errors.Wrap(err, "[magnum] Authentication failed")
+		}
+		account.tokenExpires = token.ExpiresAt
+
+		identity.TokenID = token.ID
+		identity.ReauthFunc = account.reauthenticateIdentityV3(identity)
+		identity.UserAgent.Prepend(common.BuildUserAgent())
+		identity.HTTPClient = *account.newHTTPClient(account.HTTP.Timeouts.Auth)
+		identity.EndpointLocator = token.Catalog.locate
+		magnumClient, err = openstack.NewContainerOrchestrationV1(identity, account.endpointOpts())
+		if err != nil {
+			return nil, errors.Wrap(err, "[magnum] Unable to create a Magnum client")
+		}
+	}
+
+	if magnumClient == nil {
 		common.Log.WriteDebug("[magnum] Attempting to authenticate with a password")
-		identity, err := openstack.AuthenticatedClient(*authOptions)
+		identity, err := openstack.NewClient(account.AuthEndpoint)
+		if err != nil {
+			return nil, errors.Wrap(err, "[magnum] Unable to create a new OpenStack Identity client")
+		}
+
+		// Authenticate through our http client, so that the token expiry is recorded
+		identity.HTTPClient = *account.newHTTPClient(account.HTTP.Timeouts.Auth)
+		err = openstack.Authenticate(identity, *authOptions)
 		if err != nil {
 			return nil, errors.Wrap(err, "[magnum] Authentication failed")
 		}
-		magnumClient, err = openstack.NewContainerOrchestrationV1(identity, gophercloud.EndpointOpts{Region: account.Region})
+		magnumClient, err = openstack.NewContainerOrchestrationV1(identity, account.endpointOpts())
 		if err != nil {
 			return nil, errors.Wrap(err, "[magnum] Unable to create a Magnum client")
 		}
@@ -129,7 +247,7 @@ func (account *Account) Authenticate() (*gophercloud.ServiceClient, error) {
 
 	// Apply our HTTP client customizations
 	magnumClient.UserAgent.Prepend(common.BuildUserAgent())
-	magnumClient.HTTPClient = *common.NewHTTPClient()
+	magnumClient.HTTPClient = *account.newHTTPClient(account.HTTP.Timeouts.API)
 
 	// Cache data looked up from the service catalog
 	account.token = magnumClient.TokenID
@@ -141,17 +259,69 @@ func (account *Account) Authenticate() (*gophercloud.ServiceClient, error) {
 	return magnumClient, nil
 }
 
+// isCachedTokenValid checks the cached token, skipping the round trip to identity when its expiry is known
+func (account *Account) isCachedTokenValid(testAuth func() error) bool {
+	switch {
+	case common.IsTokenFresh(account.tokenExpires):
+		common.Log.WriteDebug("[magnum] The cached token is valid until %s", account.tokenExpires)
+		return true
+	case common.IsTokenExpiring(account.tokenExpires):
+		common.Log.WriteDebug("[magnum] The cached token expires at %s, reauthenticating early", account.tokenExpires)
+		return false
+	default:
+		common.Log.WriteDebug("[magnum] Verifying the cached token, its expiry is unknown")
+		return testAuth() == nil
+	}
+}
+
+// endpointOpts selects the Magnum endpoint from the service catalog
+func (account *Account) endpointOpts() gophercloud.EndpointOpts {
+	// clouds.yaml accepts the keystone v2 style interface names too, e.g. publicURL
+	availability := strings.TrimSuffix(account.Interface, "URL")
+	return gophercloud.EndpointOpts{
+		Region:       account.Region,
+		Availability: gophercloud.Availability(availability),
+	}
+}
+
+// newHTTPClient builds our http client, which uses the account's TLS configuration and keeps the cached token and its expiry up-to-date when reauthenticating
+func (account *Account) newHTTPClient(timeout time.Duration) *http.Client {
+	client := account.HTTP.NewHTTPClient(timeout)
+	client.Transport = common.NewTokenRecorder(client.Transport, func(token string, expires time.Time) {
+		account.token = token
+		account.tokenExpires = expires
+	})
+	return client
+}
+
 func reauthenticate(identity *gophercloud.ProviderClient, authOptions *gophercloud.AuthOptions) func() error {
 	return func() error {
 		return openstack.Authenticate(identity, *authOptions)
 	}
 }
 
+// reauthenticateIdentityV3 replaces an expired token using our identity v3 client. A pre-issued token cannot be replaced.
+func (account *Account) reauthenticateIdentityV3(identity *gophercloud.ProviderClient) func() error {
+	if account.Token != "" {
+		return nil
+	}
+
+	return func() error {
+		token, err := account.authenticateIdentityV3()
+		if err != nil {
+			return err
+		}
+		identity.TokenID = token.ID
+		return nil
+	}
+}
+
 // BuildCache builds the set of data to cache
 func (account *Account) BuildCache() map[string]string {
 	return map[string]string{
-		"endpoint": account.endpoint,
-		"token":    account.token,
+		"endpoint":      account.endpoint,
+		"token":         account.token,
+		"token-expires": common.FormatTokenExpiry(account.tokenExpires),
 	}
 }
 
@@ -159,4 +329,5 @@ func (account *Account) BuildCache() map[string]string {
 func (account *Account) ApplyCache(c map[string]string) {
 	account.endpoint = c["endpoint"]
 	account.token = c["token"]
+	account.tokenExpires = common.ParseTokenExpiry(c["token-expires"])
 }
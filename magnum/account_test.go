@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/getcarina/carina/common"
 	"github.com/stretchr/testify/assert"
@@ -62,4 +63,39 @@ func TestGopherCloudIdentityV3ErrorHandlingWorkaround(t *testing.T) {
 
 	assert.NotNil(t, err)
 	assert.Contains(t, err.Error(), "unsupported protocol scheme")
-}
\ No newline at end of file
+}
+
+func TestCachedTokenExpiry(t *testing.T) {
+	testCases := []struct {
+		expires          time.Time
+		expectValid      bool
+		expectTestCalled bool
+	}{
+		{time.Now().Add(time.Hour), true, false},
+		{time.Now().Add(time.Minute), false, false},
+		{time.Time{}, true, true},
+	}
+
+	for _, tc := range testCases {
+		account := &Account{token: "cached-token", tokenExpires: tc.expires}
+
+		testCalled := false
+		valid := account.isCachedTokenValid(func() error {
+			testCalled = true
+			return nil
+		})
+
+		assert.Equal(t, tc.expectValid, valid, "expires: %s", tc.expires)
+		assert.Equal(t, tc.expectTestCalled, testCalled, "expires: %s", tc.expires)
+	}
+}
+
+func TestTokenExpiryIsCached(t *testing.T) {
+	expires := time.Date(3000, 1, 1, 12, 0, 0, 0, time.UTC)
+	account := &Account{token: "cached-token", tokenExpires: expires}
+
+	restored := &Account{}
+	restored.ApplyCache(account.BuildCache())
+
+	assert.True(t, expires.Equal(restored.tokenExpires))
+}
@@ -0,0 +1,154 @@
+package magnum
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"strings"
+
+	"github.com/getcarina/carina/common"
+	"github.com/getcarina/libcarina"
+	"github.com/gophercloud/gophercloud"
+	"github.com/pkg/errors"
+)
+
+// KeyTypeRSA is a 2048-bit RSA private key
+const KeyTypeRSA = "rsa"
+
+// KeyTypeECDSA is a P-256 ECDSA private key
+const KeyTypeECDSA = "ecdsa"
+
+// bayDetails is the subset of the Magnum bay representation needed to generate credentials
+type bayDetails struct {
+	UUID       string `json:"uuid"`
+	APIAddress string `json:"api_address"`
+	BayModelID string `json:"baymodel_id"`
+}
+
+type certificateResult struct {
+	BayUUID string `json:"bay_uuid"`
+	PEM     string `json:"pem"`
+}
+
+// generateClusterCredentials generates a private key locally, has Magnum sign a certificate signing request
+// for it and then builds the credentials bundle. The private key never leaves this machine.
+func (magnum *Magnum) generateClusterCredentials(token string) (*libcarina.CredentialsBundle, error) {
+	common.Log.WriteDebug("[magnum] Retrieving bay (%s)", token)
+	bay, err := magnum.getBayDetails(token)
+	if err != nil {
+		return nil, err
+	}
+
+	bayModel, err := magnum.lookupBayModelByID(bay.BayModelID)
+	if err != nil {
+		return nil, err
+	}
+
+	commonName := magnum.Account.CSRCommonName
+	if commonName == "" {
+		commonName = magnum.Account.UserName
+	}
+
+	common.Log.WriteDebug("[magnum] Generating a %s private key and certificate signing request for %s", magnum.Account.getCSRKeyType(), commonName)
+	key, keyPEM, err := generatePrivateKey(magnum.Account.getCSRKeyType())
+	if err != nil {
+		return nil, err
+	}
+
+	csrPEM, err := buildCertificateSigningRequest(key, commonName)
+	if err != nil {
+		return nil, err
+	}
+
+	common.Log.WriteDebug("[magnum] Signing certificate for bay (%s)", bay.UUID)
+	var cert certificateResult
+	opts := &gophercloud.RequestOpts{OkCodes: []int{200, 201}}
+	_, err = magnum.client.Post(magnum.client.ServiceURL("certificates"), map[string]string{"bay_uuid": bay.UUID, "csr": string(csrPEM)}, &cert, opts)
+	if err != nil {
+		return nil, errors.Wrap(err, "[magnum] Unable to sign the certificate signing request")
+	}
+
+	common.Log.WriteDebug("[magnum] Retrieving CA certificate for bay (%s)", bay.UUID)
+	var ca certificateResult
+	_, err = magnum.client.Get(magnum.client.ServiceURL("certificates", bay.UUID), &ca, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "[magnum] Unable to retrieve the cluster CA certificate")
+	}
+
+	creds := libcarina.NewCredentialsBundle()
+	creds.Files["ca.pem"] = []byte(ca.PEM)
+	creds.Files["cert.pem"] = []byte(cert.PEM)
+	creds.Files["key.pem"] = keyPEM
+
+	scripts, err := buildCredentialScripts(bayModel.COE, bay.APIAddress)
+	if err != nil {
+		return nil, err
+	}
+	for filename, script := range scripts {
+		creds.Files[filename] = script
+	}
+
+	return creds, nil
+}
+
+func (magnum *Magnum) getBayDetails(token string) (*bayDetails, error) {
+	var result bayDetails
+	_, err := magnum.client.Get(magnum.client.ServiceURL("bays", token), &result, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("[magnum] Unable to retrieve bay (%s)", token))
+	}
+	return &result, nil
+}
+
+func (account *Account) getCSRKeyType() string {
+	if account.CSRKeyType == "" {
+		return KeyTypeRSA
+	}
+	return strings.ToLower(account.CSRKeyType)
+}
+
+// generatePrivateKey creates a new private key and its PEM encoding
+func generatePrivateKey(keyType string) (crypto.Signer, []byte, error) {
+	switch keyType {
+	case KeyTypeRSA:
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "Unable to generate an RSA private key")
+		}
+		keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+		return key, keyPEM, nil
+	case KeyTypeECDSA:
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "Unable to generate an ECDSA private key")
+		}
+		der, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "Unable to encode the ECDSA private key")
+		}
+		keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+		return key, keyPEM, nil
+	default:
+		return nil, nil, fmt.Errorf("Invalid key type: %s. Allowed values are %s and %s", keyType, KeyTypeRSA, KeyTypeECDSA)
+	}
+}
+
+// buildCertificateSigningRequest creates a PEM encoded certificate signing request for a client certificate
+func buildCertificateSigningRequest(key crypto.Signer, commonName string) ([]byte, error) {
+	template := &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: commonName},
+	}
+
+	der, err := x509.CreateCertificateRequest(rand.Reader, template, key)
+	if err != nil {
+		return nil, errors.Wrap(err, "Unable to create the certificate signing request")
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}), nil
+}
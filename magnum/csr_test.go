@@ -0,0 +1,82 @@
+package magnum
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+
+	"github.com/getcarina/carina/common"
+	"github.com/gophercloud/gophercloud/openstack/containerorchestration/v1/baymodels"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildCertificateSigningRequest(t *testing.T) {
+	for _, keyType := range []string{KeyTypeRSA, KeyTypeECDSA} {
+		key, keyPEM, err := generatePrivateKey(keyType)
+		assert.Nil(t, err, keyType)
+		assert.NotNil(t, keyPEM, keyType)
+
+		csrPEM, err := buildCertificateSigningRequest(key, "fake-user")
+		assert.Nil(t, err, keyType)
+
+		block, _ := pem.Decode(csrPEM)
+		csr, err := x509.ParseCertificateRequest(block.Bytes)
+		assert.Nil(t, err, keyType)
+		assert.Nil(t, csr.CheckSignature(), keyType)
+		assert.Equal(t, "fake-user", csr.Subject.CommonName, keyType)
+	}
+}
+
+func TestGeneratePrivateKeyRejectsUnknownKeyType(t *testing.T) {
+	_, _, err := generatePrivateKey("dsa")
+	assert.NotNil(t, err)
+}
+
+func TestBuildCredentialScripts(t *testing.T) {
+	scripts, err := buildCredentialScripts("swarm", "10.0.0.1:2376")
+	assert.Nil(t, err)
+	assert.Contains(t, string(scripts["docker.env"]), "DOCKER_HOST=tcp://10.0.0.1:2376")
+
+	scripts, err = buildCredentialScripts("kubernetes", "https://10.0.0.1:6443")
+	assert.Nil(t, err)
+	assert.Contains(t, string(scripts["kubectl.config"]), "server: https://10.0.0.1:6443")
+
+	_, err = buildCredentialScripts("mesos", "10.0.0.1")
+	assert.NotNil(t, err)
+}
+
+func TestReplayGenerateClusterCredentials(t *testing.T) {
+	common.Log.RegisterTestLogger(t)
+	assert.Nil(t, common.StartReplay("testdata/cassette.json"))
+	defer common.StopCassette()
+
+	account := &Account{
+		AuthEndpoint:                "https://identity.example.com/v3/",
+		ApplicationCredentialID:     "fake-appcred",
+		ApplicationCredentialSecret: "fake-secret",
+		Region:                      "RegionOne",
+		CSR:                         true,
+		CSRCommonName:               "alicia",
+	}
+	svc := &Magnum{Account: account}
+	// The cassette holds the requests made by carina, skip listing the baymodels with gophercloud
+	svc.bayModelCache = map[string]*baymodels.BayModel{
+		"e9f4d7d4-8c8b-4b8e-9a58-0f4c7b0f2d21": {ID: "e9f4d7d4-8c8b-4b8e-9a58-0f4c7b0f2d21", Name: "kubernetes", COE: "kubernetes"},
+	}
+
+	creds, err := svc.GetClusterCredentials("mycluster")
+	assert.Nil(t, err)
+	if err != nil {
+		return
+	}
+
+	for _, file := range []string{"ca.pem", "cert.pem"} {
+		block, _ := pem.Decode(creds.Files[file])
+		if assert.NotNil(t, block, "Expected %s to be a PEM encoded certificate", file) {
+			_, err = x509.ParseCertificate(block.Bytes)
+			assert.Nil(t, err, "Expected the recorded %s to be replayed intact", file)
+		}
+	}
+	assert.Contains(t, string(creds.Files["key.pem"]), "PRIVATE KEY")
+	assert.Contains(t, string(creds.Files["kubectl.config"]), "server: https://172.24.4.10:6443")
+}
@@ -0,0 +1,197 @@
+package magnum
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/pkg/errors"
+)
+
+// identityToken is a token issued by OpenStack Identity v3, and the service catalog of its project
+type identityToken struct {
+	ID        string
+	ExpiresAt time.Time
+	Catalog   identityCatalog
+}
+
+// identityCatalog is the service catalog from an OpenStack Identity v3 token
+type identityCatalog []struct {
+	Type      string `json:"type"`
+	Endpoints []struct {
+		Interface string `json:"interface"`
+		Region    string `json:"region"`
+		RegionID  string `json:"region_id"`
+		URL       string `json:"url"`
+	} `json:"endpoints"`
+}
+
+// identityDomain identifies a domain by id or name
+type identityDomain struct {
+	ID   string `json:"id,omitempty"`
+	Name string `json:"name,omitempty"`
+}
+
+// newIdentityDomain identifies a domain, preferring the id over the name
+func newIdentityDomain(id string, name string) identityDomain {
+	if id != "" {
+		return identityDomain{ID: id}
+	}
+	return identityDomain{Name: name}
+}
+
+// needsIdentityV3 checks if the account uses settings which gophercloud doesn't support, and must authenticate with our identity v3 client:
+// ids, separate user and project domains, application credentials and pre-issued tokens
+func (account *Account) needsIdentityV3() bool {
+	return account.Token != "" ||
+		account.ApplicationCredentialID != "" ||
+		account.UserID != "" ||
+		account.ProjectID != "" ||
+		account.UserDomainID != "" ||
+		account.ProjectDomainID != "" ||
+		account.getUserDomain() != account.getProjectDomain()
+}
+
+func (account *Account) getUserDomain() string {
+	if account.UserDomain != "" {
+		return account.UserDomain
+	}
+	return account.Domain
+}
+
+func (account *Account) getProjectDomain() string {
+	if account.ProjectDomain != "" {
+		return account.ProjectDomain
+	}
+	return account.Domain
+}
+
+// buildIdentityRequest builds the body of an OpenStack Identity v3 token request
+func (account *Account) buildIdentityRequest() map[string]interface{} {
+	identity := map[string]interface{}{}
+
+	if account.ApplicationCredentialID != "" {
+		// Application credentials are already scoped to a project
+		identity["methods"] = []string{"application_credential"}
+		identity["application_credential"] = map[string]string{
+			"id":     account.ApplicationCredentialID,
+			"secret": account.ApplicationCredentialSecret,
+		}
+		return map[string]interface{}{"auth": map[string]interface{}{"identity": identity}}
+	}
+
+	user := map[string]interface{}{"password": account.Password}
+	if account.UserID != "" {
+		user["id"] = account.UserID
+	} else {
+		user["name"] = account.UserName
+		user["domain"] = newIdentityDomain(account.UserDomainID, account.getUserDomain())
+	}
+	identity["methods"] = []string{"password"}
+	identity["password"] = map[string]interface{}{"user": user}
+
+	auth := map[string]interface{}{"identity": identity}
+	if account.ProjectID != "" {
+		auth["scope"] = map[string]interface{}{"project": map[string]string{"id": account.ProjectID}}
+	} else if account.Project != "" {
+		auth["scope"] = map[string]interface{}{
+			"project": map[string]interface{}{
+				"name":   account.Project,
+				"domain": newIdentityDomain(account.ProjectDomainID, account.getProjectDomain()),
+			},
+		}
+	}
+
+	return map[string]interface{}{"auth": auth}
+}
+
+// authenticateIdentityV3 requests a token from OpenStack Identity v3, or when a pre-issued token is used, looks it up
+func (account *Account) authenticateIdentityV3() (*identityToken, error) {
+	tokensURL := strings.TrimSuffix(account.AuthEndpoint, "/") + "/auth/tokens"
+
+	var req *http.Request
+	var err error
+	if account.Token != "" {
+		req, err = http.NewRequest("GET", tokensURL, nil)
+		if err == nil {
+			req.Header.Add("X-Auth-Token", account.Token)
+			req.Header.Add("X-Subject-Token", account.Token)
+		}
+	} else {
+		body, _ := json.Marshal(account.buildIdentityRequest())
+		req, err = http.NewRequest("POST", tokensURL, bytes.NewReader(body))
+		if err == nil {
+			req.Header.Add("Content-Type", "application/json")
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Accept", "application/json")
+
+	resp, err := account.newHTTPClient(account.HTTP.Timeouts.Auth).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("OpenStack Identity returned %d: %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+
+	var result struct {
+		Token struct {
+			ExpiresAt time.Time       `json:"expires_at"`
+			Catalog   identityCatalog `json:"catalog"`
+		} `json:"token"`
+	}
+	err = json.Unmarshal(respBody, &result)
+	if err != nil {
+		return nil, errors.Wrap(err, "Unable to parse the token response")
+	}
+
+	token := &identityToken{
+		ID:        resp.Header.Get("X-Subject-Token"),
+		ExpiresAt: result.Token.ExpiresAt,
+		Catalog:   result.Token.Catalog,
+	}
+	if token.ID == "" {
+		token.ID = account.Token
+	}
+
+	return token, nil
+}
+
+// locate finds an endpoint in the service catalog
+func (catalog identityCatalog) locate(opts gophercloud.EndpointOpts) (string, error) {
+	availability := string(opts.Availability)
+	if availability == "" {
+		availability = string(gophercloud.AvailabilityPublic)
+	}
+
+	for _, service := range catalog {
+		if service.Type != opts.Type {
+			continue
+		}
+		for _, endpoint := range service.Endpoints {
+			if endpoint.Interface != availability {
+				continue
+			}
+			if opts.Region != "" && opts.Region != endpoint.Region && opts.Region != endpoint.RegionID {
+				continue
+			}
+			return strings.TrimSuffix(endpoint.URL, "/") + "/", nil
+		}
+	}
+
+	return "", fmt.Errorf("No %s endpoint found in the service catalog for the %s interface in region %s", opts.Type, availability, opts.Region)
+}
@@ -0,0 +1,211 @@
+package magnum
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/stretchr/testify/assert"
+)
+
+const identityV3TokenResponse = `{"token":{"expires_at":"3000-01-01T12:00:00Z","catalog":[{"type":"container-infra","endpoints":[
+	{"interface":"public","region":"RegionOne","region_id":"RegionOne","url":"https://public.example.com:9511/v1"},
+	{"interface":"internal","region":"RegionOne","region_id":"RegionOne","url":"https://internal.example.com:9511/v1/"},
+	{"interface":"public","region":"RegionTwo","region_id":"RegionTwo","url":"https://two.example.com:9511/v1"}]}]}}`
+
+func TestIdentityV3RequestWithSeparateDomains(t *testing.T) {
+	account := &Account{
+		UserName:      "alicia",
+		Password:      "ilovepuppies",
+		Project:       "admin",
+		Domain:        "Default",
+		ProjectDomain: "projects",
+	}
+	assert.True(t, account.needsIdentityV3())
+
+	body, _ := json.Marshal(account.buildIdentityRequest())
+	assert.JSONEq(t, `{"auth":{
+		"identity":{"methods":["password"],"password":{"user":{"name":"alicia","password":"ilovepuppies","domain":{"name":"Default"}}}},
+		"scope":{"project":{"name":"admin","domain":{"name":"projects"}}}}}`, string(body))
+}
+
+func TestIdentityV3RequestWithIDs(t *testing.T) {
+	account := &Account{
+		UserID:    "fake-userid",
+		Password:  "ilovepuppies",
+		ProjectID: "fake-projectid",
+	}
+
+	body, _ := json.Marshal(account.buildIdentityRequest())
+	assert.JSONEq(t, `{"auth":{
+		"identity":{"methods":["password"],"password":{"user":{"id":"fake-userid","password":"ilovepuppies"}}},
+		"scope":{"project":{"id":"fake-projectid"}}}}`, string(body))
+}
+
+func TestIdentityV3RequestWithApplicationCredential(t *testing.T) {
+	account := &Account{
+		ApplicationCredentialID:     "fake-appcred",
+		ApplicationCredentialSecret: "fake-secret",
+	}
+
+	body, _ := json.Marshal(account.buildIdentityRequest())
+	assert.JSONEq(t, `{"auth":{"identity":{"methods":["application_credential"],
+		"application_credential":{"id":"fake-appcred","secret":"fake-secret"}}}}`, string(body))
+}
+
+func TestPasswordAuthWithSingleDomainUsesGophercloud(t *testing.T) {
+	account := &Account{UserName: "alicia", Password: "ilovepuppies", Project: "admin", Domain: "Default"}
+	assert.False(t, account.needsIdentityV3())
+}
+
+func TestAuthenticateIdentityV3(t *testing.T) {
+	var requestBody string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v3/auth/tokens", r.URL.Path)
+		body, _ := ioutil.ReadAll(r.Body)
+		requestBody = string(body)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Subject-Token", "fake-token")
+		w.WriteHeader(201)
+		fmt.Fprintln(w, identityV3TokenResponse)
+	}))
+	defer server.Close()
+
+	account := &Account{
+		AuthEndpoint:                server.URL + "/v3/",
+		ApplicationCredentialID:     "fake-appcred",
+		ApplicationCredentialSecret: "fake-secret",
+	}
+
+	token, err := account.authenticateIdentityV3()
+	assert.Nil(t, err)
+	assert.Contains(t, requestBody, "application_credential")
+	assert.Equal(t, "fake-token", token.ID)
+	assert.Equal(t, 3000, token.ExpiresAt.Year())
+	assert.Len(t, token.Catalog, 1)
+}
+
+func TestAuthenticateIdentityV3WithPreIssuedToken(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "GET", r.Method)
+		assert.Equal(t, "pre-issued-token", r.Header.Get("X-Auth-Token"))
+		assert.Equal(t, "pre-issued-token", r.Header.Get("X-Subject-Token"))
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintln(w, identityV3TokenResponse)
+	}))
+	defer server.Close()
+
+	account := &Account{AuthEndpoint: server.URL + "/v3", Token: "pre-issued-token"}
+
+	token, err := account.authenticateIdentityV3()
+	assert.Nil(t, err)
+	assert.Equal(t, "pre-issued-token", token.ID)
+	assert.Nil(t, account.reauthenticateIdentityV3(nil), "A pre-issued token cannot be replaced")
+}
+
+func TestAuthenticateIdentityV3WithCustomCA(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintln(w, identityV3TokenResponse)
+	}))
+	defer server.Close()
+
+	caFile, _ := ioutil.TempFile("", "carina-cacert")
+	defer os.Remove(caFile.Name())
+	pem.Encode(caFile, &pem.Block{Type: "CERTIFICATE", Bytes: server.TLS.Certificates[0].Certificate[0]})
+	caFile.Close()
+
+	untrusted := &Account{AuthEndpoint: server.URL + "/v3", Token: "pre-issued-token"}
+	_, err := untrusted.authenticateIdentityV3()
+	assert.NotNil(t, err, "The test server's certificate should not be trusted by default")
+
+	trusted := &Account{AuthEndpoint: server.URL + "/v3", Token: "pre-issued-token"}
+	trusted.HTTP.TLS.CACert = caFile.Name()
+	assert.Nil(t, trusted.HTTP.Load())
+	_, err = trusted.authenticateIdentityV3()
+	assert.Nil(t, err)
+
+	insecure := &Account{AuthEndpoint: server.URL + "/v3", Token: "pre-issued-token"}
+	insecure.HTTP.TLS.Insecure = true
+	assert.Nil(t, insecure.HTTP.Load())
+	_, err = insecure.authenticateIdentityV3()
+	assert.Nil(t, err)
+}
+
+func TestIdentityCatalogLocate(t *testing.T) {
+	var catalog struct {
+		Token struct {
+			Catalog identityCatalog `json:"catalog"`
+		} `json:"token"`
+	}
+	json.Unmarshal([]byte(identityV3TokenResponse), &catalog)
+
+	testCases := []struct {
+		opts     gophercloud.EndpointOpts
+		expected string
+	}{
+		{gophercloud.EndpointOpts{Type: "container-infra", Region: "RegionOne"}, "https://public.example.com:9511/v1/"},
+		{gophercloud.EndpointOpts{Type: "container-infra", Region: "RegionOne", Availability: gophercloud.AvailabilityInternal}, "https://internal.example.com:9511/v1/"},
+		{gophercloud.EndpointOpts{Type: "container-infra", Region: "RegionTwo"}, "https://two.example.com:9511/v1/"},
+	}
+
+	for _, tc := range testCases {
+		endpoint, err := catalog.Token.Catalog.locate(tc.opts)
+		assert.Nil(t, err)
+		assert.Equal(t, tc.expected, endpoint)
+	}
+
+	_, err := catalog.Token.Catalog.locate(gophercloud.EndpointOpts{Type: "compute"})
+	assert.NotNil(t, err)
+}
+
+func TestGetIDIdentifiesThePrincipal(t *testing.T) {
+	base := Account{AuthEndpoint: "https://identity.example.com/v3", Region: "RegionOne"}
+
+	user := base
+	user.UserName = "alicia"
+
+	userInDomain := user
+	userInDomain.UserDomain = "users"
+
+	scoped := user
+	scoped.ProjectID = "fake-projectid"
+
+	appcred := base
+	appcred.ApplicationCredentialID = "fake-appcred"
+
+	token := base
+	token.Token = "pre-issued-token"
+
+	ids := map[string]bool{}
+	for _, account := range []Account{user, userInDomain, scoped, appcred, token} {
+		ids[account.GetID()] = true
+	}
+	assert.Len(t, ids, 5, "Expected every account to have a unique id: %v", ids)
+
+	assert.Regexp(t, `^private-[0-9a-f]{8}-regionone-alicia$`, user.GetID())
+
+	// Cache entries saved by earlier releases are still found
+	assert.Regexp(t, `^private-[0-9a-f]{8}-alicia$`, user.GetLegacyID())
+	assert.Equal(t, user.GetLegacyID(), userInDomain.GetLegacyID())
+}
+
+func TestGetClusterPrefixKeepsTheUsername(t *testing.T) {
+	user := Account{EndpointOverride: "https://magnum.example.com/v1", UserName: "alicia", UserDomain: "Default", ProjectDomain: "Default"}
+	prefix, err := user.GetClusterPrefix()
+	assert.Nil(t, err)
+	assert.Regexp(t, `^private-[0-9a-f]{8}-alicia$`, prefix)
+
+	appcred := Account{EndpointOverride: "https://magnum.example.com/v1", ApplicationCredentialID: "fake-appcred"}
+	prefix, err = appcred.GetClusterPrefix()
+	assert.Nil(t, err)
+	assert.Regexp(t, `^private-[0-9a-f]{8}-appcred-fake-appcred$`, prefix)
+}
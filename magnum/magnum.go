@@ -83,6 +83,13 @@ func (magnum *Magnum) GetClusterCredentials(token string) (*libcarina.Credential
 		return nil, err
 	}
 
+	// Generating credentials is slow on a loaded Magnum
+	defer common.OverrideTimeout(&magnum.client.HTTPClient, magnum.Account.HTTP.Timeouts.Credentials)()
+
+	if magnum.Account.CSR {
+		return magnum.generateClusterCredentials(token)
+	}
+
 	common.Log.WriteDebug("[magnum] Generating credentials bundle for cluster (%s)", token)
 
 	result, err := certificates.CreateCredentialsBundle(magnum.client, token)
@@ -101,6 +108,28 @@ func (magnum *Magnum) GetClusterCredentials(token string) (*libcarina.Credential
 	return creds, nil
 }
 
+// RotateClusterCredentials rotates the cluster's certificate authority, invalidating all previously issued credentials
+func (magnum *Magnum) RotateClusterCredentials(token string) error {
+	err := magnum.init()
+	if err != nil {
+		return err
+	}
+
+	bay, err := magnum.getBayDetails(token)
+	if err != nil {
+		return err
+	}
+
+	common.Log.WriteDebug("[magnum] Rotating the certificate authority for bay (%s)", bay.UUID)
+	opts := &gophercloud.RequestOpts{OkCodes: []int{202}}
+	_, err = magnum.client.Patch(magnum.client.ServiceURL("certificates", bay.UUID), nil, nil, opts)
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("[magnum] Unable to rotate the credentials for cluster (%s)", token))
+	}
+
+	return nil
+}
+
 // ListClusters prints out a list of the user's clusters to the console
 func (magnum *Magnum) ListClusters() ([]common.Cluster, error) {
 	err := magnum.init()
@@ -0,0 +1,110 @@
+package magnum
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// Scripts used to load a locally generated credentials bundle. They locate the bundle relative to
+// their own location, so that the bundle can be moved, e.g. with carina credentials export.
+var dockerScripts = map[string]string{
+	"docker.env": `# Run the command below to load environment variables for docker:
+# eval $(carina env <cluster-name>)
+export DOCKER_HOST={{.Host}}
+export DOCKER_TLS_VERIFY=1
+export DOCKER_CERT_PATH=$(cd "$(dirname "${BASH_SOURCE[0]:-$0}")" && pwd)
+`,
+	"docker.fish": `set -x DOCKER_HOST {{.Host}}
+set -x DOCKER_TLS_VERIFY 1
+set -x DOCKER_CERT_PATH (dirname (status -f))
+`,
+	"docker.ps1": `$env:DOCKER_HOST="{{.Host}}"
+$env:DOCKER_TLS_VERIFY="1"
+$env:DOCKER_CERT_PATH=$PSScriptRoot
+`,
+	"docker.cmd": `set DOCKER_HOST={{.Host}}
+set DOCKER_TLS_VERIFY=1
+set DOCKER_CERT_PATH=%~dp0
+`,
+}
+
+var kubernetesScripts = map[string]string{
+	"kubectl.config": `apiVersion: v1
+kind: Config
+clusters:
+- cluster:
+    certificate-authority: ca.pem
+    server: {{.Host}}
+  name: cluster
+contexts:
+- context:
+    cluster: cluster
+    user: admin
+  name: default
+current-context: default
+users:
+- name: admin
+  user:
+    client-certificate: cert.pem
+    client-key: key.pem
+`,
+	"kubectl.env": `# Run the command below to load environment variables for kubectl:
+# eval $(carina env <cluster-name>)
+export KUBECONFIG=$(cd "$(dirname "${BASH_SOURCE[0]:-$0}")" && pwd)/kubectl.config
+`,
+	"kubectl.fish": `set -x KUBECONFIG (dirname (status -f))/kubectl.config
+`,
+	"kubectl.ps1": `$env:KUBECONFIG="$PSScriptRoot\kubectl.config"
+`,
+	"kubectl.cmd": `set KUBECONFIG=%~dp0kubectl.config
+`,
+}
+
+// buildCredentialScripts generates the scripts which configure docker or kubectl to use a credentials bundle
+func buildCredentialScripts(coe string, apiAddress string) (map[string][]byte, error) {
+	if apiAddress == "" {
+		return nil, fmt.Errorf("The cluster does not have an API address yet, wait until it is active and try again")
+	}
+
+	var scripts map[string]string
+	var data struct {
+		Host string
+	}
+
+	switch strings.ToLower(coe) {
+	case "swarm", "swarm-mode":
+		scripts = dockerScripts
+		data.Host = apiAddress
+		if !strings.Contains(apiAddress, "://") {
+			data.Host = "tcp://" + apiAddress
+		}
+	case "kubernetes":
+		scripts = kubernetesScripts
+		data.Host = apiAddress
+		if !strings.Contains(apiAddress, "://") {
+			data.Host = "https://" + apiAddress
+		}
+	default:
+		return nil, fmt.Errorf("Generating credentials locally is not supported for %s clusters", coe)
+	}
+
+	results := make(map[string][]byte)
+	for filename, text := range scripts {
+		t, err := template.New(filename).Parse(text)
+		if err != nil {
+			return nil, err
+		}
+
+		var script bytes.Buffer
+		err = t.Execute(&script, data)
+		if err != nil {
+			return nil, err
+		}
+
+		results[filename] = script.Bytes()
+	}
+
+	return results, nil
+}
@@ -3,16 +3,19 @@ package makecoe
 import (
 	"crypto/sha1"
 	"fmt"
-
+	"net/http"
 	"regexp"
-
 	"strings"
+	"time"
 
 	"github.com/getcarina/carina/common"
 	"github.com/getcarina/libcarina"
 	"github.com/pkg/errors"
 )
 
+// libcarinaUserAgent is the user agent set by libcarina.NewClient
+const libcarinaUserAgent = "getcarina/libcarina"
+
 // Account is a set of authentication credentials accepted by Rackspace Identity
 type Account struct {
 	// Optional custom endpoint specified by the user
@@ -24,9 +27,13 @@ type Account struct {
 	// Testing only, not used by the cli
 	AuthEndpointOverride string
 
+	// HTTP customizes the connections to Rackspace Identity and the Carina API
+	HTTP common.HTTPOptions
+
 	// The endpoint from the service catalog
-	endpoint string
-	token    string
+	endpoint     string
+	token        string
+	tokenExpires time.Time
 }
 
 // NewClusterService create the appropriate ClusterService for the account
@@ -34,8 +41,16 @@ func (account *Account) NewClusterService() common.ClusterService {
 	return &MakeCOE{Account: account}
 }
 
-// GetID returns a unique id for the account, e.g. public-[username]
+// GetID returns a unique id for the account, e.g. public-[username], or public-[region]-[username] when a region is specified
 func (account *Account) GetID() string {
+	if account.Region != "" {
+		return fmt.Sprintf("public-%s-%s", strings.ToLower(account.Region), account.UserName)
+	}
+	return fmt.Sprintf("public-%s", account.UserName)
+}
+
+// GetLegacyID returns the id used by earlier releases, which did not include the region, e.g. public-[username]
+func (account *Account) GetLegacyID() string {
 	return fmt.Sprintf("public-%s", account.UserName)
 }
 
@@ -64,8 +79,21 @@ func (account *Account) getEndpoint() string {
 }
 
 func (account *Account) getEndpointRegion() string {
+	return parseEndpointRegion(account.getEndpoint())
+}
+
+// MatchesLegacyEndpoint checks that an endpoint cached under the legacy id, which did not include the region, is for the account's region
+func (account *Account) MatchesLegacyEndpoint(endpoint string) bool {
+	if account.Region == "" {
+		return true
+	}
+	return strings.EqualFold(parseEndpointRegion(endpoint), account.Region)
+}
+
+// parseEndpointRegion returns the region of a Carina API endpoint, e.g. https://api.dfw.getcarina.com
+func parseEndpointRegion(endpoint string) string {
 	re := regexp.MustCompile(`https://api\.([^.]*)\.getcarina\.com`)
-	match := re.FindStringSubmatch(account.getEndpoint())
+	match := re.FindStringSubmatch(endpoint)
 	if len(match) < 2 {
 		return ""
 	}
@@ -75,19 +103,44 @@ func (account *Account) getEndpointRegion() string {
 
 // Authenticate creates an authenticated client, ready to use to communicate with the Carina API
 func (account *Account) Authenticate() (*libcarina.CarinaClient, error) {
+	if err := account.HTTP.Load(); err != nil {
+		return nil, errors.Wrap(err, "[make-coe] Unable to load the TLS configuration")
+	}
+
+	var carinaClient *libcarina.CarinaClient
 	if account.token != "" && account.endpoint != "" {
-		common.Log.WriteDebug("[make-coe] Attempting to authenticate with a cached token, falling back to the username and apikey if necessary")
+		switch {
+		case common.IsTokenFresh(account.tokenExpires):
+			// Use the cached token as-is, libcarina.NewClient would make a round trip to verify it
+			common.Log.WriteDebug("[make-coe] Authenticating with a cached token, valid until %s", account.tokenExpires)
+			carinaClient = &libcarina.CarinaClient{
+				Username:  account.UserName,
+				Token:     account.token,
+				Endpoint:  account.endpoint,
+				UserAgent: libcarinaUserAgent,
+			}
+		case common.IsTokenExpiring(account.tokenExpires):
+			common.Log.WriteDebug("[make-coe] Discarding cached token which expires at %s, reauthenticating early", account.tokenExpires)
+			account.token = ""
+			account.tokenExpires = time.Time{}
+			account.endpoint = ""
+		default:
+			common.Log.WriteDebug("[make-coe] Attempting to authenticate with a cached token, falling back to the username and apikey if necessary")
+		}
 	} else {
 		common.Log.WriteDebug("[make-coe] Attempting to authenticate with a username and apikey")
 	}
-	carinaClient, err := libcarina.NewClient(account.UserName, account.APIKey, account.Region, account.AuthEndpointOverride, account.token, account.endpoint)
-	if err != nil {
-		return nil, errors.Wrap(err, "[make-coe] Authentication failed")
+
+	if carinaClient == nil {
+		var err error
+		carinaClient, err = account.newClient()
+		if err != nil {
+			return nil, err
+		}
 	}
-	common.Log.WriteDebug("[make-coe] Authentication sucessful")
 
-	// Apply our http client customizations
-	carinaClient.Client = common.NewHTTPClient()
+	// Apply our http client customizations, deleting a cluster is safe to retry because a 404 is treated as success
+	carinaClient.Client = account.HTTP.NewHTTPClientWithRetries(account.HTTP.Timeouts.API, common.DefaultRetryPolicy.WithDeletes())
 	carinaClient.UserAgent += common.BuildUserAgent()
 
 	// Cache data looked up from the service catalog
@@ -100,16 +153,47 @@ func (account *Account) Authenticate() (*libcarina.CarinaClient, error) {
 	return carinaClient, nil
 }
 
+// newClient authenticates with libcarina, which verifies the cached token or requests a new one
+func (account *Account) newClient() (*libcarina.CarinaClient, error) {
+	// libcarina authenticates with the default http client, which has no timeout.
+	// Apply the auth timeout, and record the expiry of the tokens issued by Rackspace Identity.
+	issued := make(map[string]time.Time)
+	restore := common.OverrideDefaultTransport(func(transport http.RoundTripper) http.RoundTripper {
+		transport = common.NewTimeoutTransport(transport, account.HTTP.Timeouts.Auth)
+		return common.NewTokenRecorder(transport, func(token string, expires time.Time) {
+			issued[token] = expires
+		})
+	})
+	carinaClient, err := libcarina.NewClient(account.UserName, account.APIKey, account.Region, account.AuthEndpointOverride, account.token, account.endpoint)
+	restore()
+	if err != nil {
+		return nil, errors.Wrap(err, "[make-coe] Authentication failed")
+	}
+	common.Log.WriteDebug("[make-coe] Authentication sucessful")
+
+	if carinaClient.Token != account.token {
+		// The expiry is unknown when the identity service didn't include it
+		account.tokenExpires = issued[carinaClient.Token]
+		if !account.tokenExpires.IsZero() {
+			common.Log.WriteDebug("[make-coe] The token is valid until %s", account.tokenExpires)
+		}
+	}
+
+	return carinaClient, nil
+}
+
 // BuildCache builds the set of data to cache
 func (account *Account) BuildCache() map[string]string {
 	return map[string]string{
-		"token":    account.token,
-		"endpoint": account.endpoint,
+		"token":         account.token,
+		"token-expires": common.FormatTokenExpiry(account.tokenExpires),
+		"endpoint":      account.endpoint,
 	}
 }
 
 // ApplyCache applies a set of cached data
 func (account *Account) ApplyCache(c map[string]string) {
 	account.token = c["token"]
+	account.tokenExpires = common.ParseTokenExpiry(c["token-expires"])
 	account.endpoint = c["endpoint"]
 }
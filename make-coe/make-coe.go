@@ -3,6 +3,7 @@ package makecoe
 import (
 	"fmt"
 	"net/http"
+	"path"
 	"strings"
 	"time"
 
@@ -98,6 +99,7 @@ func (carina *MakeCOE) GetClusterCredentials(token string) (*libcarina.Credentia
 	}
 
 	common.Log.WriteDebug("[make-coe] Retrieving cluster credentials (%s)", token)
+	defer common.OverrideTimeout(carina.client.Client, carina.Account.HTTP.Timeouts.Credentials)()
 	creds, err := carina.client.GetCredentials(token)
 	if err != nil {
 		return nil, handleLibcarinaError(errors.Wrap(err, "[make-coe] Unable to retrieve the cluster credentials"))
@@ -106,6 +108,28 @@ func (carina *MakeCOE) GetClusterCredentials(token string) (*libcarina.Credentia
 	return creds, nil
 }
 
+// RotateClusterCredentials resets the cluster's credentials by its id or name (if unique), invalidating all previously issued credentials
+func (carina *MakeCOE) RotateClusterCredentials(token string) error {
+	err := carina.init()
+	if err != nil {
+		return err
+	}
+
+	cluster, err := carina.client.Get(token)
+	if err != nil {
+		return handleLibcarinaError(errors.Wrap(err, "[make-coe] Unable to retrieve the cluster"))
+	}
+
+	common.Log.WriteDebug("[make-coe] Resetting cluster credentials (%s)", cluster.ID)
+	resp, err := carina.client.NewRequest("POST", path.Join("/clusters", cluster.ID, "credentials", "reset"), nil)
+	if err != nil {
+		return handleLibcarinaError(errors.Wrap(err, "[make-coe] Unable to reset the cluster credentials"))
+	}
+	resp.Body.Close()
+
+	return nil
+}
+
 // ListClusters prints out a list of the user's clusters to the console
 func (carina *MakeCOE) ListClusters() ([]common.Cluster, error) {
 	var clusters []common.Cluster
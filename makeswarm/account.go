@@ -14,6 +14,10 @@ import (
 type Account struct {
 	UserName string
 	APIKey   string
+
+	// HTTP customizes the connections to Rackspace Identity and the Carina API
+	HTTP common.HTTPOptions
+
 	token    string
 	endpoint string
 }
@@ -35,6 +39,10 @@ func (account *Account) GetClusterPrefix() (string, error) {
 
 // Authenticate creates an authenticated client, ready to use to communicate with the Carina API
 func (account *Account) Authenticate() (*libcarina.ClusterClient, error) {
+	if err := account.HTTP.Load(); err != nil {
+		return nil, errors.Wrap(err, "[make-swarm] Unable to load the TLS configuration")
+	}
+
 	var carinaClient *libcarina.ClusterClient
 
 	testAuth := func() error {
@@ -47,7 +55,7 @@ func (account *Account) Authenticate() (*libcarina.ClusterClient, error) {
 		req.Header.Add("X-Auth-Token", account.token)
 		req.Header.Add("User-Agent", common.BuildUserAgent())
 
-		resp, err := common.NewHTTPClient().Do(req)
+		resp, err := account.HTTP.NewHTTPClient(account.HTTP.Timeouts.Auth).Do(req)
 		if err != nil {
 			return err
 		}
@@ -66,7 +74,7 @@ func (account *Account) Authenticate() (*libcarina.ClusterClient, error) {
 		if testAuth() == nil {
 			common.Log.WriteDebug("[make-swarm] Authentication sucessful")
 			carinaClient = &libcarina.ClusterClient{
-				Client:    common.NewHTTPClient(),
+				Client:    account.HTTP.NewHTTPClient(account.HTTP.Timeouts.API),
 				Username:  account.UserName,
 				Token:     account.token,
 				Endpoint:  libcarina.BetaEndpoint,
@@ -87,7 +95,7 @@ func (account *Account) Authenticate() (*libcarina.ClusterClient, error) {
 	}
 	common.Log.WriteDebug("[make-swarm] Authentication sucessful")
 
-	carinaClient.Client = common.NewHTTPClient()
+	carinaClient.Client = account.HTTP.NewHTTPClient(account.HTTP.Timeouts.API)
 	carinaClient.UserAgent = common.BuildUserAgent()
 	account.token = carinaClient.Token
 
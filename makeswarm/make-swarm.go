@@ -90,6 +90,7 @@ func (carina *MakeSwarm) GetClusterCredentials(name string) (*libcarina.Credenti
 	}
 
 	common.Log.WriteDebug("[make-swarm] Retrieving cluster credentials (%s)", name)
+	defer common.OverrideTimeout(carina.client.Client, carina.Account.HTTP.Timeouts.Credentials)()
 	result, err := carina.client.GetCredentials(name)
 	if err != nil {
 		return nil, errors.Wrap(err, "[make-swarm] Unable to retrieve the cluster credentials")
@@ -100,6 +101,11 @@ func (carina *MakeSwarm) GetClusterCredentials(name string) (*libcarina.Credenti
 	return creds, nil
 }
 
+// RotateClusterCredentials is not supported
+func (carina *MakeSwarm) RotateClusterCredentials(name string) error {
+	return errors.New("[make-swarm] Rotating cluster credentials is not supported. Delete and recreate the cluster to invalidate its existing credentials.")
+}
+
 // ListClusters prints out a list of the user's clusters to the console
 func (carina *MakeSwarm) ListClusters() ([]common.Cluster, error) {
 	err := carina.init()